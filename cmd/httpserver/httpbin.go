@@ -7,13 +7,14 @@ import (
 	"io"
 	"log/slog"
 	"net/http"
+	"net/url"
 
 	"github.com/austin-weeks/http-from-scratch/internal/headers"
 	"github.com/austin-weeks/http-from-scratch/internal/response"
 )
 
-func proxyHTTPBin(path string, w *response.Writer) {
-	path = fmt.Sprintf("https://httpbin.org/%s", path)
+func proxyHTTPBin(path, rawQuery string, w *response.Writer) {
+	path = (&url.URL{Scheme: "https", Host: "httpbin.org", Path: "/" + path, RawQuery: rawQuery}).String()
 	r, err := http.Get(path)
 	if err != nil {
 		slog.Error("failed to fetch from httpbin", "error", err, "path", path)
@@ -26,11 +27,14 @@ func proxyHTTPBin(path string, w *response.Writer) {
 		slog.Error("failed to write status line", "error", err, "path", path)
 		return
 	}
+	err = w.DeclareTrailer("X-Content-SHA256", "X-Content-Length")
+	if err != nil {
+		slog.Error("failed to declare trailers", "error", err, "path", path)
+		return
+	}
 	h := headers.NewHeaders()
-	h.Set("Connection", "close")
 	h.Set("Content-Type", "application/json")
 	h.Set("Transfer-Encoding", "chunked")
-	h.Set("Trailers", "X-Content-SHA256, X-Content-Length")
 
 	err = w.WriteHeaders(h)
 	if err != nil {
@@ -54,11 +58,6 @@ func proxyHTTPBin(path string, w *response.Writer) {
 			slog.Error("failed to write httpbin response body", "error", err, "path", path, "body", buf[n:])
 		}
 	}
-	_, err = w.WriteChunkedBodyDone()
-	if err != nil {
-		slog.Error("failed to write httpbin response body", "error", err, "path", path)
-		return
-	}
 	t := headers.NewHeaders()
 	t.Set("X-Content-SHA256", fmt.Sprint(sha256.Sum256(body)))
 	t.Set("X-Content-Length", fmt.Sprint(len(body)))
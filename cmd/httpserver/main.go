@@ -1,53 +1,68 @@
 package main
 
 import (
+	"context"
+	"fmt"
 	"log"
 	"log/slog"
 	"os"
 	"os/signal"
-	"strings"
 	"syscall"
+	"time"
 
 	"github.com/austin-weeks/http-from-scratch/internal/request"
 	"github.com/austin-weeks/http-from-scratch/internal/response"
 	"github.com/austin-weeks/http-from-scratch/internal/server"
 )
 
-const port = 42069
+const (
+	port            = 42069
+	shutdownTimeout = 10 * time.Second
+)
 
 func main() {
-	server, err := server.Serve(port, handler)
+	server, err := server.ServeConfig(server.Config{
+		Addr:              fmt.Sprintf(":%d", port),
+		ReadHeaderTimeout: 5 * time.Second,
+		ReadTimeout:       30 * time.Second,
+		WriteTimeout:      30 * time.Second,
+		IdleTimeout:       60 * time.Second,
+	}, server.Chain(newRouter().Serve, server.Recover, server.RequestID, server.Logger))
 	if err != nil {
 		log.Fatalf("Error starting server: %v", err)
 	}
-	defer server.Close() // nolint
 	log.Println("Server started on port", port)
 
 	sigChan := make(chan os.Signal, 1)
 	signal.Notify(sigChan, syscall.SIGINT, syscall.SIGTERM)
 	<-sigChan
-	log.Println("Server gracefully stopped")
-}
 
-func handler(w *response.Writer, r *request.Request) {
-	if path, ok := strings.CutPrefix(r.RequestLine.RequestTarget, "/httpbin/"); ok {
-		proxyHTTPBin(path, w)
+	ctx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+	defer cancel()
+	dropped, err := server.Shutdown(ctx)
+	if err != nil {
+		log.Printf("Server stopped, dropping %d connections: %v", dropped, err)
 		return
 	}
+	log.Println("Server gracefully stopped")
+}
 
-	var statusCode response.StatusCode
-	var body []byte
-	switch r.RequestLine.RequestTarget {
-	case "/video":
-		if r.RequestLine.Method != "GET" {
-			statusCode = response.StatusBadRequest
-			break
-		}
+func newRouter() *server.Router {
+	rt := server.NewRouter()
+	rt.Handle("GET", "/httpbin/{path...}", func(w *response.Writer, r *request.Request) {
+		proxyHTTPBin(r.PathValue("path"), r.RequestLine.Target.RawQuery, w)
+	})
+	rt.Handle("GET", "/video", func(w *response.Writer, _ *request.Request) {
 		sendVideo(w)
-		return
-	case "/yourproblem":
-		statusCode = response.StatusBadRequest
-		body = []byte(`
+	})
+	rt.Handle("GET", "/yourproblem", yourProblem)
+	rt.Handle("GET", "/myproblem", myProblem)
+	rt.Handle("GET", "/{path...}", success)
+	return rt
+}
+
+func yourProblem(w *response.Writer, r *request.Request) {
+	writeHTML(w, r, response.StatusBadRequest, []byte(`
 <html>
   <head>
     <title>400 Bad Request</title>
@@ -56,11 +71,11 @@ func handler(w *response.Writer, r *request.Request) {
     <h1>Bad Request</h1>
     <p>Your request honestly kinda sucked.</p>
   </body>
-</html>`)
+</html>`))
+}
 
-	case "/myproblem":
-		statusCode = response.StatusInternalError
-		body = []byte(`
+func myProblem(w *response.Writer, r *request.Request) {
+	writeHTML(w, r, response.StatusInternalError, []byte(`
 <html>
   <head>
     <title>500 Internal Server Error</title>
@@ -69,10 +84,11 @@ func handler(w *response.Writer, r *request.Request) {
     <h1>Internal Server Error</h1>
     <p>Okay, you know what? This one is on me.</p>
   </body>
-</html>`)
-	default:
-		statusCode = response.StatusOK
-		body = []byte(`
+</html>`))
+}
+
+func success(w *response.Writer, r *request.Request) {
+	writeHTML(w, r, response.StatusOK, []byte(`
 <html>
   <head>
     <title>200 OK</title>
@@ -81,21 +97,16 @@ func handler(w *response.Writer, r *request.Request) {
     <h1>Success!</h1>
     <p>Your request was an absolute banger.</p>
   </body>
-</html>`)
-	}
-	h := response.GetDefaultHeaders(len(body))
-	h.OverwriteSet("Content-Type", "text/html")
+</html>`))
+}
 
+func writeHTML(w *response.Writer, r *request.Request, statusCode response.StatusCode, body []byte) {
 	err := w.WriteStatusLine(statusCode)
 	if err != nil {
 		slog.Error("failed to write status line", "error", err, "request", r)
 	}
 
-	err = w.WriteHeaders(h)
-	if err != nil {
-		slog.Error("failed to write headers", "error", err, "request", r)
-	}
-
+	w.Header().Set("Content-Type", "text/html")
 	_, err = w.WriteBody(body)
 	if err != nil {
 		slog.Error("failed to write body", "error", err, "request", r)
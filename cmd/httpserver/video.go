@@ -15,7 +15,7 @@ func sendVideo(w *response.Writer) {
 	v, err := os.Open("./assets/vim.mp4")
 	if err != nil {
 		slog.Error("failed to open video file", "error", err)
-		_ = w.WriteStatusLine(404)
+		_ = w.WriteStatusLine(response.StatusNotFound)
 		h := headers.NewHeaders()
 		h.Set("Connection", "close")
 		_ = w.WriteHeaders(h)
@@ -31,7 +31,6 @@ func sendVideo(w *response.Writer) {
 	_ = w.WriteStatusLine(response.StatusOK)
 
 	h := headers.NewHeaders()
-	h.Set("Connection", "close")
 	h.Set("Content-Type", "video/mp4")
 	h.Set("Content-Length", fmt.Sprint(s.Size()))
 
@@ -6,53 +6,183 @@ import (
 	"errors"
 	"fmt"
 	"regexp"
+	"slices"
 	"strings"
 )
 
 var (
 	crlf           = []byte("\r\n")
-	fieldNameRegex = regexp.MustCompile("^[a-zA-Z0-9!#$%&'*+-./^_`|~]+$")
+	fieldNameRegex = regexp.MustCompile("^[a-zA-Z0-9!#$%&'*+\\-.^_`|~]+$")
 )
 
+// ObsFoldPolicy selects how Parse treats obsolete line folding, a field
+// value continued on a line starting with a space or tab.
+type ObsFoldPolicy int
+
+const (
+	// RejectObsFold fails Parse with ErrMalformedField.
+	RejectObsFold ObsFoldPolicy = iota
+	// ReplaceObsFold joins the continuation to the previous field value with
+	// a single space, as RFC 9112 allows.
+	ReplaceObsFold
+)
+
+var (
+	// ErrMalformedField is returned by Parse for a field line that is not a
+	// valid "name: value" pair, and by Add, Set and OverwriteSet for a name
+	// or value that cannot be sent, e.g. one containing CR or LF.
+	ErrMalformedField = errors.New("malformed header field")
+	// ErrFieldsTooLarge is returned by Parse when the header block exceeds
+	// the limits set with Limit.
+	ErrFieldsTooLarge = errors.New("header fields too large")
+)
+
+// Headers holds HTTP fields keyed by case-insensitive name. A name may
+// carry several values; fields such as Set-Cookie cannot be combined into
+// one comma-separated line. Fields keep the order they were added in and
+// the casing of the name they were added with, so they are written out the
+// way they were received or set.
 type Headers struct {
-	hMap map[string]string
+	fields  []field
+	obsFold ObsFoldPolicy
+	// Parse limits, zero meaning unlimited, and usage so far
+	maxBytes    int
+	maxCount    int
+	parsedBytes int
+	count       int
+}
+
+type field struct {
+	name  string
+	value string
 }
 
 func NewHeaders() *Headers {
-	return &Headers{
-		hMap: make(map[string]string),
-	}
+	return &Headers{}
 }
 
+// Get returns the first value for key, or "" if there is none. Use Values
+// for fields that may repeat.
 func (h *Headers) Get(key string) string {
-	return h.hMap[strings.ToLower(key)]
+	for _, f := range h.fields {
+		if strings.EqualFold(f.name, key) {
+			return f.value
+		}
+	}
+	return ""
 }
 
-func (h *Headers) Set(name, value string) {
-	name = strings.ToLower(name)
-	if v, ok := h.hMap[name]; ok {
-		value = fmt.Sprintf("%s, %s", v, value)
+// Values returns every value for key in the order they were added.
+func (h *Headers) Values(key string) []string {
+	var values []string
+	for _, f := range h.fields {
+		if strings.EqualFold(f.name, key) {
+			values = append(values, f.value)
+		}
 	}
+	return values
+}
 
-	h.hMap[name] = value
+// Add appends a field, keeping any existing values for name. Invalid names
+// and values are rejected, so they cannot be used to inject extra fields
+// into a response.
+func (h *Headers) Add(name, value string) error {
+	if err := validateField(name, value); err != nil {
+		return err
+	}
+	h.fields = append(h.fields, field{name: name, value: value})
+	return nil
 }
 
-func (h *Headers) OverwriteSet(name, value string) {
-	name = strings.ToLower(name)
-	h.hMap[name] = value
+// Set adds value to name, keeping any existing values. It is equivalent to
+// Add.
+func (h *Headers) Set(name, value string) error {
+	return h.Add(name, value)
 }
 
+// OverwriteSet replaces every value for name with value. The field keeps
+// the position of the first value it replaces. On error h is unchanged.
+func (h *Headers) OverwriteSet(name, value string) error {
+	if err := validateField(name, value); err != nil {
+		return err
+	}
+	i := slices.IndexFunc(h.fields, func(f field) bool {
+		return strings.EqualFold(f.name, name)
+	})
+	if i == -1 {
+		h.fields = append(h.fields, field{name: name, value: value})
+		return nil
+	}
+	rest := slices.DeleteFunc(h.fields[i+1:], func(f field) bool {
+		return strings.EqualFold(f.name, name)
+	})
+	h.fields[i] = field{name: name, value: value}
+	h.fields = h.fields[:i+1+len(rest)]
+	return nil
+}
+
+// Del removes every value for name.
+func (h *Headers) Del(name string) {
+	h.fields = slices.DeleteFunc(h.fields, func(f field) bool {
+		return strings.EqualFold(f.name, name)
+	})
+}
+
+// ForEach calls fn for each field in the order they were added, so a name
+// with several values is visited several times.
 func (h *Headers) ForEach(fn func(k, v string)) {
-	for k, v := range h.hMap {
-		fn(k, v)
+	for _, f := range h.fields {
+		fn(f.name, f.value)
 	}
 }
 
+// ForEachSorted is like ForEach, but visits fields sorted by name, ignoring
+// case. Values for the same name keep their order. It is meant for tests
+// and other output that should not depend on how fields were added.
+func (h *Headers) ForEachSorted(fn func(k, v string)) {
+	fields := slices.Clone(h.fields)
+	slices.SortStableFunc(fields, func(a, b field) int {
+		return strings.Compare(strings.ToLower(a.name), strings.ToLower(b.name))
+	})
+	for _, f := range fields {
+		fn(f.name, f.value)
+	}
+}
+
+// Clone returns a copy of h that can be modified independently.
+func (h *Headers) Clone() *Headers {
+	c := *h
+	c.fields = slices.Clone(h.fields)
+	return &c
+}
+
+// SetObsFoldPolicy sets how Parse handles obsolete line folding. The
+// default is RejectObsFold.
+func (h *Headers) SetObsFoldPolicy(p ObsFoldPolicy) {
+	h.obsFold = p
+}
+
+// Limit bounds the total number of bytes and the number of fields Parse
+// accepts. A value of 0 means no limit.
+func (h *Headers) Limit(maxBytes, maxCount int) {
+	h.maxBytes = maxBytes
+	h.maxCount = maxCount
+}
+
 func (h *Headers) Parse(data []byte) (n int, done bool, err error) {
 	i := bytes.Index(data, crlf)
+	if j := bytes.IndexByte(data, '\n'); j != -1 && (i == -1 || j < i) {
+		return 0, false, fmt.Errorf("%w: line not terminated by CRLF", ErrMalformedField)
+	}
 	if i == -1 {
+		if h.maxBytes > 0 && h.parsedBytes+len(data) > h.maxBytes {
+			return 0, false, ErrFieldsTooLarge
+		}
 		return 0, false, nil
 	}
+	if h.maxBytes > 0 && h.parsedBytes+i+len(crlf) > h.maxBytes {
+		return 0, false, ErrFieldsTooLarge
+	}
 	// End of headers
 	if i == 0 {
 		return len(crlf), true, nil
@@ -60,20 +190,87 @@ func (h *Headers) Parse(data []byte) (n int, done bool, err error) {
 
 	read := i + len(crlf)
 	header := data[:i]
-	header = bytes.TrimSpace(header)
+	if header[0] == ' ' || header[0] == '\t' {
+		if err := h.unfold(header); err != nil {
+			return 0, false, err
+		}
+		h.parsedBytes += read
+		return read, false, nil
+	}
 
 	i = bytes.Index(header, []byte(":"))
 	if i == -1 {
-		return 0, false, errors.New("no colon found in header line")
+		return 0, false, fmt.Errorf("%w: no colon found in header line", ErrMalformedField)
 	}
 	name, value := header[:i], header[i+1:]
+	if len(name) > 0 && (name[len(name)-1] == ' ' || name[len(name)-1] == '\t') {
+		return 0, false, fmt.Errorf("%w: whitespace before colon", ErrMalformedField)
+	}
 	if !fieldNameRegex.Match(name) {
-		return 0, false, errors.New("field name contains invalid characters")
+		return 0, false, fmt.Errorf("%w: field name contains invalid characters", ErrMalformedField)
+	}
+	value = bytes.Trim(value, " \t")
+	if !validValue(value) {
+		return 0, false, fmt.Errorf("%w: field value contains invalid characters", ErrMalformedField)
 	}
-	nameStr := string(bytes.ToLower(name))
-	valueStr := string(bytes.TrimSpace(value))
 
-	h.Set(nameStr, valueStr)
+	h.count++
+	if h.maxCount > 0 && h.count > h.maxCount {
+		return 0, false, ErrFieldsTooLarge
+	}
+	h.parsedBytes += read
+	h.fields = append(h.fields, field{name: string(name), value: string(value)})
 
 	return read, false, nil
 }
+
+// unfold handles an obs-fold continuation line according to the policy.
+func (h *Headers) unfold(line []byte) error {
+	if h.obsFold != ReplaceObsFold {
+		return fmt.Errorf("%w: obsolete line folding", ErrMalformedField)
+	}
+	// The continuation must follow a field parsed in this block
+	if h.count == 0 {
+		return fmt.Errorf("%w: continuation line without a field", ErrMalformedField)
+	}
+	line = bytes.Trim(line, " \t")
+	if !validValue(line) {
+		return fmt.Errorf("%w: field value contains invalid characters", ErrMalformedField)
+	}
+	last := &h.fields[len(h.fields)-1]
+	if len(line) > 0 {
+		if last.value != "" {
+			last.value += " "
+		}
+		last.value += string(line)
+	}
+	return nil
+}
+
+// ValidName reports whether name is a valid field name, i.e. a token as
+// defined by RFC 9110.
+func ValidName(name string) bool {
+	return fieldNameRegex.MatchString(name)
+}
+
+func validateField(name, value string) error {
+	if !ValidName(name) {
+		return fmt.Errorf("%w: invalid field name %q", ErrMalformedField, name)
+	}
+	if !validValue([]byte(value)) {
+		return fmt.Errorf("%w: invalid value for %s", ErrMalformedField, name)
+	}
+	return nil
+}
+
+// validValue reports whether v is a valid field value as defined by RFC
+// 9110: visible characters, obs-text, spaces and tabs, but no other
+// control characters.
+func validValue(v []byte) bool {
+	for _, b := range v {
+		if b < ' ' && b != '\t' || b == 0x7f {
+			return false
+		}
+	}
+	return true
+}
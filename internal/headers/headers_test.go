@@ -63,5 +63,164 @@ func TestHeadersParsing(t *testing.T) {
 	headers.Set("Accept", "application/json")
 	_, _, err = headers.Parse([]byte("Accept: xml\r\n"))
 	require.NoError(t, err)
-	assert.Equal(t, "application/json, xml", headers.Get("Accept"))
+	assert.Equal(t, "application/json", headers.Get("Accept"))
+	assert.Equal(t, []string{"application/json", "xml"}, headers.Values("Accept"))
+
+	// Test: Set-Cookie values kept apart
+	headers = NewHeaders()
+	_, _, err = headers.Parse([]byte("Set-Cookie: a=1; Expires=Wed, 21 Oct 2015 07:28:00 GMT\r\n"))
+	require.NoError(t, err)
+	headers.Add("Set-Cookie", "b=2")
+	assert.Equal(t, []string{"a=1; Expires=Wed, 21 Oct 2015 07:28:00 GMT", "b=2"}, headers.Values("set-cookie"))
+
+	// Test: OverwriteSet and Del
+	headers.OverwriteSet("Set-Cookie", "c=3")
+	assert.Equal(t, []string{"c=3"}, headers.Values("Set-Cookie"))
+	headers.Del("SET-COOKIE")
+	assert.Empty(t, headers.Values("Set-Cookie"))
+	assert.Equal(t, "", headers.Get("Set-Cookie"))
+}
+
+func TestHeadersLimits(t *testing.T) {
+	// Test: Within limits
+	headers := NewHeaders()
+	headers.Limit(64, 2)
+	data := []byte("Host: localhost:42069\r\nAccept: */*\r\n\r\n")
+	n, _, err := headers.Parse(data)
+	require.NoError(t, err)
+	n2, _, err := headers.Parse(data[n:])
+	require.NoError(t, err)
+	_, done, err := headers.Parse(data[n+n2:])
+	require.NoError(t, err)
+	assert.True(t, done)
+
+	// Test: Too many fields
+	headers = NewHeaders()
+	headers.Limit(0, 1)
+	n, _, err = headers.Parse(data)
+	require.NoError(t, err)
+	_, _, err = headers.Parse(data[n:])
+	assert.ErrorIs(t, err, ErrFieldsTooLarge)
+
+	// Test: Too many bytes
+	headers = NewHeaders()
+	headers.Limit(30, 0)
+	n, _, err = headers.Parse(data)
+	require.NoError(t, err)
+	_, _, err = headers.Parse(data[n:])
+	assert.ErrorIs(t, err, ErrFieldsTooLarge)
+
+	// Test: Unterminated line over the limit
+	headers = NewHeaders()
+	headers.Limit(16, 0)
+	_, _, err = headers.Parse([]byte("X-Endless: aaaaaaaaaaaaaaaa"))
+	assert.ErrorIs(t, err, ErrFieldsTooLarge)
+}
+
+// collect returns the fields visited by each as "name: value" lines.
+func collect(each func(fn func(k, v string))) []string {
+	var lines []string
+	each(func(k, v string) {
+		lines = append(lines, k+": "+v)
+	})
+	return lines
+}
+
+func TestHeadersOrder(t *testing.T) {
+	// Test: Parsed fields keep their order and casing
+	headers := NewHeaders()
+	data := []byte("Host: a\r\nx-lower: 1\r\nSet-Cookie: a=1\r\nACCEPT: */*\r\nset-cookie: b=2\r\n\r\n")
+	for {
+		n, done, err := headers.Parse(data)
+		require.NoError(t, err)
+		data = data[n:]
+		if done {
+			break
+		}
+	}
+	want := []string{"Host: a", "x-lower: 1", "Set-Cookie: a=1", "ACCEPT: */*", "set-cookie: b=2"}
+	for range 10 {
+		assert.Equal(t, want, collect(headers.ForEach))
+	}
+
+	// Test: Sorted iteration
+	assert.Equal(t, []string{"ACCEPT: */*", "Host: a", "Set-Cookie: a=1", "set-cookie: b=2", "x-lower: 1"},
+		collect(headers.ForEachSorted))
+
+	// Test: OverwriteSet keeps the first position
+	headers.OverwriteSet("Set-Cookie", "c=3")
+	assert.Equal(t, []string{"Host: a", "x-lower: 1", "Set-Cookie: c=3", "ACCEPT: */*"}, collect(headers.ForEach))
+
+	// Test: Clone is independent
+	clone := headers.Clone()
+	clone.Add("X-Extra", "1")
+	clone.Del("Host")
+	assert.Equal(t, "a", headers.Get("Host"))
+	assert.Empty(t, headers.Values("X-Extra"))
+	assert.Equal(t, []string{"x-lower: 1", "Set-Cookie: c=3", "ACCEPT: */*", "X-Extra: 1"}, collect(clone.ForEach))
+}
+
+func TestHeadersValidation(t *testing.T) {
+	// Test: Control characters in values
+	for _, line := range []string{"X-A: a\x00b\r\n", "X-A: a\rb\r\n", "X-A: a\x7fb\r\n", "X-A: a\x1bb\r\n"} {
+		_, _, err := NewHeaders().Parse([]byte(line))
+		assert.ErrorIs(t, err, ErrMalformedField, "%q", line)
+	}
+
+	// Test: Tabs and obs-text allowed
+	headers := NewHeaders()
+	_, _, err := headers.Parse([]byte("X-A: \tcaf\xc3\xa9\tau lait \t\r\n"))
+	require.NoError(t, err)
+	assert.Equal(t, "caf\xc3\xa9\tau lait", headers.Get("X-A"))
+
+	// Test: Separators in names
+	for _, line := range []string{"X,A: 1\r\n", "X/A: 1\r\n", "X A: 1\r\n"} {
+		_, _, err := NewHeaders().Parse([]byte(line))
+		assert.ErrorIs(t, err, ErrMalformedField, "%q", line)
+	}
+
+	// Test: Set rejects CRLF injection
+	headers = NewHeaders()
+	assert.ErrorIs(t, headers.Set("Location", "/a\r\nSet-Cookie: x=1"), ErrMalformedField)
+	assert.ErrorIs(t, headers.Add("X-A", "a\nb"), ErrMalformedField)
+	assert.ErrorIs(t, headers.Set("X-A\r\nB", "1"), ErrMalformedField)
+	require.NoError(t, headers.Set("X-A", "1"))
+	assert.ErrorIs(t, headers.OverwriteSet("X-A", "\r\n"), ErrMalformedField)
+	assert.Equal(t, []string{"1"}, headers.Values("X-A"))
+
+	// Test: ValidName
+	assert.True(t, ValidName("X-Content-SHA256"))
+	assert.False(t, ValidName(""))
+	assert.False(t, ValidName("X-A\r\nB"))
+}
+
+func TestHeadersObsFold(t *testing.T) {
+	data := []byte("X-Long: first\r\n  second\r\n\tthird\r\nHost: a\r\n\r\n")
+
+	// Test: Rejected by default
+	headers := NewHeaders()
+	n, _, err := headers.Parse(data)
+	require.NoError(t, err)
+	_, _, err = headers.Parse(data[n:])
+	assert.ErrorIs(t, err, ErrMalformedField)
+
+	// Test: Replaced with a space
+	headers = NewHeaders()
+	headers.SetObsFoldPolicy(ReplaceObsFold)
+	for {
+		n, done, err := headers.Parse(data)
+		require.NoError(t, err)
+		data = data[n:]
+		if done {
+			break
+		}
+	}
+	assert.Equal(t, "first second third", headers.Get("X-Long"))
+	assert.Equal(t, "a", headers.Get("Host"))
+
+	// Test: Continuation without a field
+	headers = NewHeaders()
+	headers.SetObsFoldPolicy(ReplaceObsFold)
+	_, _, err = headers.Parse([]byte(" orphan\r\n"))
+	assert.ErrorIs(t, err, ErrMalformedField)
 }
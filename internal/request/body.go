@@ -0,0 +1,85 @@
+package request
+
+import (
+	"errors"
+	"io"
+)
+
+// bodyReader decodes a request body directly from the connection as it is
+// read.
+type bodyReader struct {
+	rr     *Reader
+	r      *Request
+	closed bool
+}
+
+func (b *bodyReader) Read(p []byte) (int, error) {
+	if b.closed {
+		return 0, errors.New("read on closed body")
+	}
+	return b.read(p)
+}
+
+func (b *bodyReader) read(p []byte) (int, error) {
+	if b.r.state == done {
+		return 0, io.EOF
+	}
+	if len(p) == 0 {
+		return 0, nil
+	}
+
+	// parse appends decoded body bytes to the window, so point it at p
+	b.r.window = p[:0]
+	b.r.bodyLimit = len(p)
+	err := b.rr.advance(b.r, func() bool {
+		return len(b.r.window) > 0 || b.r.state == done
+	})
+	n := len(b.r.window)
+	b.r.window = nil
+	b.r.bodyLimit = 0
+	if err != nil {
+		return n, err
+	}
+	if n == 0 && b.r.state == done {
+		return 0, io.EOF
+	}
+	return n, nil
+}
+
+// Close prevents further reads by the handler. Any unread body bytes remain
+// on the connection until discarded with DiscardBody.
+func (b *bodyReader) Close() error {
+	b.closed = true
+	return nil
+}
+
+// ErrBodyTooLarge is returned by DiscardBody when more than the allowed
+// number of unread body bytes remain.
+var ErrBodyTooLarge = errors.New("unread request body exceeds discard limit")
+
+// DiscardBody closes the body to the handler, then reads and throws away
+// whatever is left of a streamed request body, so the next request on the
+// connection can be read. It works regardless of what BodyReader has been
+// set to. It gives up with ErrBodyTooLarge after max bytes, in which case
+// the connection should not be reused. It is a no-op for fully buffered
+// requests.
+func (r *Request) DiscardBody(max int64) error {
+	b := r.body
+	if b == nil {
+		return nil
+	}
+	b.closed = true
+	buf := make([]byte, 4096)
+	var discarded int64
+	for discarded <= max {
+		n, err := b.read(buf)
+		discarded += int64(n)
+		if errors.Is(err, io.EOF) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return ErrBodyTooLarge
+}
@@ -0,0 +1,233 @@
+package request
+
+import (
+	"io"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestStreamingBody(t *testing.T) {
+	// Test: Content-Length body read lazily
+	reader := &chunkReader{
+		data: "POST /submit HTTP/1.1\r\n" +
+			"Content-Length: 13\r\n" +
+			"\r\n" +
+			"hello world!\n",
+		numBytesPerRead: 3,
+	}
+	rr := NewReader(reader)
+	r, err := rr.ReadRequestHeaders()
+	require.NoError(t, err)
+	assert.Equal(t, "/submit", r.RequestLine.RequestTarget)
+	assert.Empty(t, r.Body)
+	assert.Less(t, reader.pos, len(reader.data))
+	body, err := io.ReadAll(r.BodyReader)
+	require.NoError(t, err)
+	assert.Equal(t, "hello world!\n", string(body))
+
+	// Test: Chunked body with trailers read lazily
+	reader = &chunkReader{
+		data: "POST /submit HTTP/1.1\r\n" +
+			"Transfer-Encoding: chunked\r\n" +
+			"\r\n" +
+			"6\r\n" +
+			"hello \r\n" +
+			"7\r\n" +
+			"world!\n\r\n" +
+			"0\r\n" +
+			"X-Checksum: abc\r\n" +
+			"\r\n",
+		numBytesPerRead: 4,
+	}
+	rr = NewReader(reader)
+	r, err = rr.ReadRequestHeaders()
+	require.NoError(t, err)
+	buf := make([]byte, 2)
+	var got []byte
+	for {
+		n, err := r.BodyReader.Read(buf)
+		got = append(got, buf[:n]...)
+		if err == io.EOF {
+			break
+		}
+		require.NoError(t, err)
+	}
+	assert.Equal(t, "hello world!\n", string(got))
+	assert.Equal(t, "abc", r.Trailers.Get("X-Checksum"))
+
+	// Test: No body
+	reader = &chunkReader{
+		data:            "GET / HTTP/1.1\r\n\r\n",
+		numBytesPerRead: 5,
+	}
+	rr = NewReader(reader)
+	r, err = rr.ReadRequestHeaders()
+	require.NoError(t, err)
+	n, err := r.BodyReader.Read(buf)
+	assert.Equal(t, 0, n)
+	assert.ErrorIs(t, err, io.EOF)
+
+	// Test: Body shorter than Content-Length
+	reader = &chunkReader{
+		data: "POST /submit HTTP/1.1\r\n" +
+			"Content-Length: 20\r\n" +
+			"\r\n" +
+			"partial",
+		numBytesPerRead: 3,
+	}
+	rr = NewReader(reader)
+	r, err = rr.ReadRequestHeaders()
+	require.NoError(t, err)
+	_, err = io.ReadAll(r.BodyReader)
+	assert.Error(t, err)
+
+	// Test: Read after Close
+	reader = &chunkReader{
+		data: "POST /submit HTTP/1.1\r\n" +
+			"Content-Length: 5\r\n" +
+			"\r\n" +
+			"hello",
+		numBytesPerRead: 3,
+	}
+	rr = NewReader(reader)
+	r, err = rr.ReadRequestHeaders()
+	require.NoError(t, err)
+	require.NoError(t, r.BodyReader.Close())
+	_, err = r.BodyReader.Read(buf)
+	assert.Error(t, err)
+}
+
+// spyReader calls spy before each read from r.
+type spyReader struct {
+	r   io.Reader
+	spy func()
+}
+
+func (s *spyReader) Read(p []byte) (int, error) {
+	s.spy()
+	return s.r.Read(p)
+}
+
+func TestStreamingBodyLeavesBodyEmpty(t *testing.T) {
+	// Test: Body never aliases the caller's buffer mid-read
+	var r *Request
+	var seen [][]byte
+	reader := &spyReader{
+		r: &chunkReader{
+			data: "POST /submit HTTP/1.1\r\n" +
+				"Content-Length: 11\r\n" +
+				"\r\n" +
+				"hello world",
+			numBytesPerRead: 4,
+		},
+		spy: func() {
+			if r != nil {
+				seen = append(seen, r.Body)
+			}
+		},
+	}
+	rr := NewReader(reader)
+	r, err := rr.ReadRequestHeaders()
+	require.NoError(t, err)
+	body, err := io.ReadAll(r.BodyReader)
+	require.NoError(t, err)
+	assert.Equal(t, "hello world", string(body))
+	require.NotEmpty(t, seen)
+	for _, b := range seen {
+		assert.Nil(t, b)
+	}
+	assert.Nil(t, r.Body)
+}
+
+func TestStreamingBodyReadSize(t *testing.T) {
+	// Test: Large body read in large pieces, not through the header buffer
+	body := strings.Repeat("x", 1<<20)
+	reader := &chunkReader{
+		data: "POST /upload HTTP/1.1\r\n" +
+			"Content-Length: 1048576\r\n" +
+			"\r\n" +
+			body,
+		numBytesPerRead: 1 << 20,
+	}
+	rr := NewReader(reader)
+	r, err := rr.ReadRequestHeaders()
+	require.NoError(t, err)
+	n, err := io.Copy(io.Discard, r.BodyReader)
+	require.NoError(t, err)
+	assert.Equal(t, int64(len(body)), n)
+	assert.Less(t, reader.reads, 100)
+}
+
+func TestDiscardBody(t *testing.T) {
+	// Test: Unread body discarded before the next request
+	reader := &chunkReader{
+		data: "POST /submit HTTP/1.1\r\n" +
+			"Content-Length: 11\r\n" +
+			"\r\n" +
+			"hello world" +
+			"GET /next HTTP/1.1\r\n" +
+			"\r\n",
+		numBytesPerRead: 6,
+	}
+	rr := NewReader(reader)
+	r, err := rr.ReadRequestHeaders()
+	require.NoError(t, err)
+	buf := make([]byte, 3)
+	_, err = r.BodyReader.Read(buf)
+	require.NoError(t, err)
+	require.NoError(t, r.BodyReader.Close())
+	require.NoError(t, r.DiscardBody(1024))
+	r, err = rr.ReadRequestHeaders()
+	require.NoError(t, err)
+	assert.Equal(t, "/next", r.RequestLine.RequestTarget)
+
+	// Test: Body reader wrapped by the handler
+	reader = &chunkReader{
+		data: "POST /submit HTTP/1.1\r\n" +
+			"Content-Length: 26\r\n" +
+			"\r\n" +
+			"GET /smuggled HTTP/1.1\r\n\r\n" +
+			"GET /next HTTP/1.1\r\n" +
+			"\r\n",
+		numBytesPerRead: 6,
+	}
+	rr = NewReader(reader)
+	r, err = rr.ReadRequestHeaders()
+	require.NoError(t, err)
+	r.BodyReader = io.NopCloser(io.LimitReader(r.BodyReader, 3))
+	require.NoError(t, r.DiscardBody(1024))
+	r, err = rr.ReadRequestHeaders()
+	require.NoError(t, err)
+	assert.Equal(t, "/next", r.RequestLine.RequestTarget)
+
+	// Test: Body larger than discard limit
+	reader = &chunkReader{
+		data: "POST /submit HTTP/1.1\r\n" +
+			"Content-Length: 11\r\n" +
+			"\r\n" +
+			"hello world",
+		numBytesPerRead: 6,
+	}
+	rr = NewReader(reader)
+	r, err = rr.ReadRequestHeaders()
+	require.NoError(t, err)
+	assert.ErrorIs(t, r.DiscardBody(4), ErrBodyTooLarge)
+
+	// Test: Buffered request
+	reader = &chunkReader{
+		data: "POST /submit HTTP/1.1\r\n" +
+			"Content-Length: 5\r\n" +
+			"\r\n" +
+			"hello",
+		numBytesPerRead: 6,
+	}
+	r, err = RequestFromReader(reader)
+	require.NoError(t, err)
+	require.NoError(t, r.DiscardBody(0))
+	body, err := io.ReadAll(r.BodyReader)
+	require.NoError(t, err)
+	assert.Equal(t, "hello", string(body))
+}
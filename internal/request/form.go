@@ -0,0 +1,412 @@
+package request
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/austin-weeks/http-from-scratch/internal/headers"
+)
+
+var (
+	// ErrNotForm is returned by ParseForm for a body that is neither
+	// application/x-www-form-urlencoded nor multipart/form-data.
+	ErrNotForm = errors.New("request body is not a form")
+	// ErrMalformedForm is returned by ParseForm for a body that does not
+	// match its Content-Type.
+	ErrMalformedForm = errors.New("malformed form body")
+	// ErrFormTooLarge is returned by ParseForm when the body exceeds
+	// FormLimits.MaxBytes or FormLimits.MaxParts.
+	ErrFormTooLarge = errors.New("form too large")
+)
+
+// FormLimits bounds the forms ParseForm accepts. A value of 0 means no
+// limit.
+type FormLimits struct {
+	// MaxBytes bounds the size of the whole body.
+	MaxBytes int64
+	// MaxMemory is how many bytes of uploaded files are kept in memory.
+	// Files past this are written to temporary files instead.
+	MaxMemory int64
+	// MaxParts bounds the number of fields and files.
+	MaxParts int
+	// MaxPartHeaderBytes bounds the header block of each multipart part.
+	MaxPartHeaderBytes int
+}
+
+// DefaultFormLimits are sensible limits for ParseForm.
+var DefaultFormLimits = FormLimits{
+	MaxBytes:           32 << 20,
+	MaxMemory:          1 << 20,
+	MaxParts:           1000,
+	MaxPartHeaderBytes: 8 << 10,
+}
+
+// Form holds a parsed form body.
+type Form struct {
+	// Values holds the fields that are not file uploads.
+	Values Query
+	// Files holds uploaded files by field name.
+	Files map[string][]*FormFile
+}
+
+// FormFile is a file uploaded in a multipart form. Its content is held in
+// memory or, once FormLimits.MaxMemory is used up, in a temporary file that
+// is deleted by Form.RemoveAll.
+type FormFile struct {
+	// Filename is the name the client gave the file, with any directory
+	// components removed.
+	Filename string
+	// Header holds the part's header fields, e.g. Content-Type.
+	Header *headers.Headers
+	Size   int64
+
+	content []byte
+	tmpFile string
+}
+
+// Open returns a reader for the file's content.
+func (f *FormFile) Open() (io.ReadCloser, error) {
+	if f.tmpFile != "" {
+		return os.Open(f.tmpFile)
+	}
+	return io.NopCloser(bytes.NewReader(f.content)), nil
+}
+
+// RemoveAll deletes the temporary files holding uploaded files. Handlers
+// should defer it once ParseForm succeeds.
+func (f *Form) RemoveAll() error {
+	var errs []error
+	for _, files := range f.Files {
+		for _, file := range files {
+			if file.tmpFile == "" {
+				continue
+			}
+			if err := os.Remove(file.tmpFile); err != nil && !errors.Is(err, os.ErrNotExist) {
+				errs = append(errs, err)
+			}
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// ParseForm reads the body as an application/x-www-form-urlencoded or
+// multipart/form-data form, as given by Content-Type. The body is consumed,
+// so later calls return the same form.
+func (r *Request) ParseForm(limits FormLimits) (*Form, error) {
+	if r.form != nil {
+		return r.form, nil
+	}
+	mediaType, params := parseMediaType(r.Headers.Get("Content-Type"))
+	body := io.Reader(r.BodyReader)
+	if limits.MaxBytes > 0 {
+		body = &maxBytesReader{r: body, left: limits.MaxBytes}
+	}
+
+	var form *Form
+	var err error
+	switch mediaType {
+	case "application/x-www-form-urlencoded":
+		form, err = parseURLEncoded(body)
+	case "multipart/form-data":
+		form, err = parseMultipart(body, params["boundary"], limits)
+	default:
+		return nil, fmt.Errorf("%w: Content-Type %q", ErrNotForm, mediaType)
+	}
+	if err != nil {
+		return nil, err
+	}
+	r.form = form
+	return form, nil
+}
+
+func parseURLEncoded(body io.Reader) (*Form, error) {
+	data, err := io.ReadAll(body)
+	if err != nil {
+		return nil, err
+	}
+	values, ok := parseQuery(string(data))
+	if !ok {
+		return nil, fmt.Errorf("%w: invalid percent-encoding", ErrMalformedForm)
+	}
+	return &Form{Values: values, Files: make(map[string][]*FormFile)}, nil
+}
+
+// multipartReader reads the parts of a multipart body one at a time.
+type multipartReader struct {
+	br     *bufio.Reader
+	limits FormLimits
+	// delim separates parts: CRLF, "--" and the boundary
+	delim []byte
+	// memLeft is how much file content may still be held in memory.
+	memLeft int64
+}
+
+func parseMultipart(body io.Reader, boundary string, limits FormLimits) (*Form, error) {
+	if boundary == "" || len(boundary) > 70 {
+		return nil, fmt.Errorf("%w: missing or invalid boundary", ErrMalformedForm)
+	}
+	mr := &multipartReader{
+		// The first boundary may start the body, so act as if it was
+		// preceded by a line break like the rest
+		br:      bufio.NewReaderSize(io.MultiReader(strings.NewReader("\r\n"), body), 4096),
+		limits:  limits,
+		delim:   []byte("\r\n--" + boundary),
+		memLeft: limits.MaxMemory,
+	}
+	if limits.MaxMemory == 0 {
+		mr.memLeft = -1
+	}
+
+	form := &Form{Values: make(Query), Files: make(map[string][]*FormFile)}
+	// Skip the preamble
+	if err := mr.copyPart(io.Discard); err != nil {
+		return nil, err
+	}
+	for parts := 0; ; parts++ {
+		more, err := mr.nextPart()
+		if err != nil {
+			_ = form.RemoveAll()
+			return nil, err
+		}
+		if !more {
+			return form, nil
+		}
+		if limits.MaxParts > 0 && parts >= limits.MaxParts {
+			_ = form.RemoveAll()
+			return nil, fmt.Errorf("%w: more than %d parts", ErrFormTooLarge, limits.MaxParts)
+		}
+		if err := mr.readPart(form); err != nil {
+			_ = form.RemoveAll()
+			return nil, err
+		}
+	}
+}
+
+// nextPart consumes the remainder of a boundary line, reporting whether it
+// starts another part or ends the body.
+func (mr *multipartReader) nextPart() (bool, error) {
+	suffix, err := mr.br.ReadSlice('\n')
+	if err != nil {
+		if errors.Is(err, io.EOF) && bytes.HasPrefix(suffix, []byte("--")) {
+			return false, nil
+		}
+		return false, mr.wrapErr(err)
+	}
+	if bytes.HasPrefix(suffix, []byte("--")) {
+		// Anything after the final boundary is an epilogue to ignore
+		return false, nil
+	}
+	// Transport padding may follow the boundary
+	if len(bytes.TrimRight(suffix, " \t\r\n")) != 0 || !bytes.HasSuffix(suffix, crlf) {
+		return false, fmt.Errorf("%w: invalid boundary line", ErrMalformedForm)
+	}
+	return true, nil
+}
+
+// readPart reads one part's headers and content into form.
+func (mr *multipartReader) readPart(form *Form) error {
+	h := headers.NewHeaders()
+	h.Limit(mr.limits.MaxPartHeaderBytes, 0)
+	for {
+		line, err := mr.br.ReadSlice('\n')
+		if errors.Is(err, bufio.ErrBufferFull) {
+			return fmt.Errorf("%w: part header line too long", ErrFormTooLarge)
+		}
+		if err != nil {
+			return mr.wrapErr(err)
+		}
+		_, done, err := h.Parse(line)
+		if errors.Is(err, headers.ErrFieldsTooLarge) {
+			return fmt.Errorf("%w: part headers too large", ErrFormTooLarge)
+		}
+		if err != nil {
+			return fmt.Errorf("%w: %w", ErrMalformedForm, err)
+		}
+		if done {
+			break
+		}
+	}
+
+	disposition, params := parseMediaType(h.Get("Content-Disposition"))
+	name, ok := params["name"]
+	if disposition != "form-data" || !ok {
+		return fmt.Errorf("%w: part without a form-data Content-Disposition", ErrMalformedForm)
+	}
+	filename, isFile := params["filename"]
+	if !isFile {
+		var value bytes.Buffer
+		if err := mr.copyPart(&value); err != nil {
+			return err
+		}
+		form.Values[name] = append(form.Values[name], value.String())
+		return nil
+	}
+
+	file := &FormFile{
+		Filename: baseName(filename),
+		Header:   h,
+	}
+	// Record the file before writing it, so RemoveAll finds a temporary
+	// file even if reading the part fails
+	form.Files[name] = append(form.Files[name], file)
+	w := &fileWriter{file: file, memLeft: &mr.memLeft}
+	err := mr.copyPart(w)
+	if w.tmp != nil {
+		if cerr := w.tmp.Close(); err == nil {
+			err = cerr
+		}
+	}
+	return err
+}
+
+// baseName returns the last element of a client-supplied file name, split
+// on both "/" and "\". Names that are empty or refer to a directory, such
+// as "." and "..", become "".
+func baseName(name string) string {
+	if i := strings.LastIndexAny(name, `/\`); i != -1 {
+		name = name[i+1:]
+	}
+	if name == "." || name == ".." {
+		return ""
+	}
+	return name
+}
+
+// copyPart copies part content to w up to the next delimiter, which is
+// consumed.
+func (mr *multipartReader) copyPart(w io.Writer) error {
+	for {
+		buf, err := mr.br.Peek(mr.br.Size())
+		if i := bytes.Index(buf, mr.delim); i != -1 {
+			if _, err := w.Write(buf[:i]); err != nil {
+				return err
+			}
+			_, _ = mr.br.Discard(i + len(mr.delim))
+			return nil
+		}
+		if err != nil && !errors.Is(err, bufio.ErrBufferFull) {
+			return mr.wrapErr(err)
+		}
+		// Keep enough bytes to find a delimiter split across reads
+		n := len(buf) - len(mr.delim) + 1
+		if _, err := w.Write(buf[:n]); err != nil {
+			return err
+		}
+		_, _ = mr.br.Discard(n)
+	}
+}
+
+// wrapErr reports a body that ended in the middle of a part as malformed.
+func (mr *multipartReader) wrapErr(err error) error {
+	if errors.Is(err, io.EOF) {
+		return fmt.Errorf("%w: body ended before the final boundary", ErrMalformedForm)
+	}
+	return err
+}
+
+// fileWriter holds file content in memory while memLeft allows, then moves
+// it to a temporary file.
+type fileWriter struct {
+	file    *FormFile
+	memLeft *int64
+	tmp     *os.File
+}
+
+func (fw *fileWriter) Write(p []byte) (int, error) {
+	fw.file.Size += int64(len(p))
+	if fw.tmp == nil && (*fw.memLeft < 0 || int64(len(p)) <= *fw.memLeft) {
+		if *fw.memLeft >= 0 {
+			*fw.memLeft -= int64(len(p))
+		}
+		fw.file.content = append(fw.file.content, p...)
+		return len(p), nil
+	}
+	if fw.tmp == nil {
+		tmp, err := os.CreateTemp("", "form-upload-")
+		if err != nil {
+			return 0, err
+		}
+		fw.tmp = tmp
+		fw.file.tmpFile = tmp.Name()
+		// Memory held so far is handed back
+		*fw.memLeft += int64(len(fw.file.content))
+		if _, err := tmp.Write(fw.file.content); err != nil {
+			return 0, err
+		}
+		fw.file.content = nil
+	}
+	return fw.tmp.Write(p)
+}
+
+// maxBytesReader fails with ErrFormTooLarge once more than left bytes have
+// been read.
+type maxBytesReader struct {
+	r    io.Reader
+	left int64
+}
+
+func (m *maxBytesReader) Read(p []byte) (int, error) {
+	if int64(len(p)) > m.left+1 {
+		p = p[:m.left+1]
+	}
+	n, err := m.r.Read(p)
+	m.left -= int64(n)
+	if m.left < 0 {
+		return 0, ErrFormTooLarge
+	}
+	return n, err
+}
+
+// parseMediaType splits a header value such as Content-Type into its lower
+// case media type and parameters, e.g. `form-data; name="file"`. Parameter
+// names are lower case; quoted values are unquoted.
+func parseMediaType(v string) (string, map[string]string) {
+	mediaType, rest, _ := strings.Cut(v, ";")
+	params := make(map[string]string)
+	for {
+		rest = strings.TrimLeft(rest, " \t;")
+		if rest == "" {
+			break
+		}
+		name, after, ok := strings.Cut(rest, "=")
+		if !ok {
+			break
+		}
+		name = strings.ToLower(strings.TrimSpace(name))
+		after = strings.TrimLeft(after, " \t")
+		var value string
+		value, rest = parseParamValue(after)
+		params[name] = value
+	}
+	return strings.ToLower(strings.TrimSpace(mediaType)), params
+}
+
+// parseParamValue reads a token or quoted-string from the start of s,
+// returning it and the rest of s.
+func parseParamValue(s string) (string, string) {
+	if !strings.HasPrefix(s, `"`) {
+		end := strings.IndexByte(s, ';')
+		if end == -1 {
+			end = len(s)
+		}
+		return strings.TrimSpace(s[:end]), s[end:]
+	}
+	var b strings.Builder
+	for i := 1; i < len(s); i++ {
+		switch c := s[i]; {
+		case c == '"':
+			return b.String(), s[i+1:]
+		case c == '\\' && i+1 < len(s):
+			i++
+			b.WriteByte(s[i])
+		default:
+			b.WriteByte(c)
+		}
+	}
+	return b.String(), ""
+}
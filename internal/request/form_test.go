@@ -0,0 +1,178 @@
+package request
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// formRequest reads a POST request with the given Content-Type and body,
+// leaving the body to be streamed.
+func formRequest(t *testing.T, contentType, body string) *Request {
+	t.Helper()
+	data := fmt.Sprintf("POST /upload HTTP/1.1\r\nContent-Type: %s\r\nContent-Length: %d\r\n\r\n%s",
+		contentType, len(body), body)
+	r, err := NewReader(&chunkReader{data: data, numBytesPerRead: 7}).ReadRequestHeaders()
+	require.NoError(t, err)
+	return r
+}
+
+func readFile(t *testing.T, f *FormFile) string {
+	t.Helper()
+	rc, err := f.Open()
+	require.NoError(t, err)
+	defer rc.Close() // nolint
+	b, err := io.ReadAll(rc)
+	require.NoError(t, err)
+	return string(b)
+}
+
+func TestParseFormURLEncoded(t *testing.T) {
+	r := formRequest(t, "application/x-www-form-urlencoded; charset=utf-8", "name=Ada+Lovelace&lang=go&lang=c%2B%2B&empty=")
+	form, err := r.ParseForm(DefaultFormLimits)
+	require.NoError(t, err)
+	assert.Equal(t, "Ada Lovelace", form.Values.Get("name"))
+	assert.Equal(t, []string{"go", "c++"}, form.Values["lang"])
+	assert.True(t, form.Values.Has("empty"))
+	assert.Empty(t, form.Files)
+
+	// Test: Second call returns the same form
+	again, err := r.ParseForm(DefaultFormLimits)
+	require.NoError(t, err)
+	assert.Same(t, form, again)
+
+	// Test: Invalid escape
+	r = formRequest(t, "application/x-www-form-urlencoded", "a=%zz")
+	_, err = r.ParseForm(DefaultFormLimits)
+	assert.ErrorIs(t, err, ErrMalformedForm)
+
+	// Test: Too large
+	r = formRequest(t, "application/x-www-form-urlencoded", "a="+strings.Repeat("x", 100))
+	_, err = r.ParseForm(FormLimits{MaxBytes: 50})
+	assert.ErrorIs(t, err, ErrFormTooLarge)
+
+	// Test: Not a form
+	r = formRequest(t, "application/json", "{}")
+	_, err = r.ParseForm(DefaultFormLimits)
+	assert.ErrorIs(t, err, ErrNotForm)
+}
+
+const multipartBody = "preamble to ignore\r\n" +
+	"--XyZ\r\n" +
+	"Content-Disposition: form-data; name=\"title\"\r\n" +
+	"\r\n" +
+	"Hello\r\nWorld\r\n" +
+	"--XyZ  \r\n" +
+	"Content-Disposition: form-data; name=\"upload\"; filename=\"C:/docs/notes.txt\"\r\n" +
+	"Content-Type: text/plain\r\n" +
+	"\r\n" +
+	"small file\r\n" +
+	"--XyZ\r\n" +
+	"content-disposition: form-data; name=\"upload\"; filename=\"big \\\"one\\\".bin\"\r\n" +
+	"\r\n" +
+	"%s\r\n" +
+	"--XyZ--\r\n" +
+	"epilogue to ignore"
+
+func TestParseFormMultipart(t *testing.T) {
+	big := strings.Repeat("0123456789", 1000) + "--XyZ is not a boundary"
+	r := formRequest(t, `multipart/form-data; boundary="XyZ"`, fmt.Sprintf(multipartBody, big))
+	form, err := r.ParseForm(FormLimits{MaxMemory: 100})
+	require.NoError(t, err)
+
+	assert.Equal(t, "Hello\r\nWorld", form.Values.Get("title"))
+	files := form.Files["upload"]
+	require.Len(t, files, 2)
+
+	// Test: Small file kept in memory
+	assert.Equal(t, "notes.txt", files[0].Filename)
+	assert.Equal(t, "text/plain", files[0].Header.Get("Content-Type"))
+	assert.Equal(t, int64(10), files[0].Size)
+	assert.Empty(t, files[0].tmpFile)
+	assert.Equal(t, "small file", readFile(t, files[0]))
+
+	// Test: Large file spooled to disk
+	assert.Equal(t, `big "one".bin`, files[1].Filename)
+	assert.Equal(t, int64(len(big)), files[1].Size)
+	require.NotEmpty(t, files[1].tmpFile)
+	assert.Equal(t, big, readFile(t, files[1]))
+
+	// Test: RemoveAll deletes temporary files
+	require.NoError(t, form.RemoveAll())
+	_, err = os.Stat(files[1].tmpFile)
+	assert.ErrorIs(t, err, os.ErrNotExist)
+}
+
+func TestParseFormFilename(t *testing.T) {
+	tests := []struct {
+		sent string
+		want string
+	}{
+		{"notes.txt", "notes.txt"},
+		{"", ""},
+		{".", ""},
+		{"..", ""},
+		{"a/../..", ""},
+		{"/etc/passwd", "passwd"},
+		// Backslashes are escaped inside the quoted filename parameter
+		{`C:\\Users\\me\\notes.txt`, "notes.txt"},
+		{`..\\..\\evil.txt`, "evil.txt"},
+		{"dir/", ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.sent, func(t *testing.T) {
+			body := "--b\r\nContent-Disposition: form-data; name=\"f\"; filename=\"" + tt.sent + "\"\r\n\r\n" +
+				"x\r\n--b--\r\n"
+			r := formRequest(t, "multipart/form-data; boundary=b", body)
+			form, err := r.ParseForm(DefaultFormLimits)
+			require.NoError(t, err)
+			require.Len(t, form.Files["f"], 1)
+			assert.Equal(t, tt.want, form.Files["f"][0].Filename)
+		})
+	}
+}
+
+func TestParseFormMultipartErrors(t *testing.T) {
+	part := "--b\r\nContent-Disposition: form-data; name=\"a\"\r\n\r\n1\r\n"
+	tests := []struct {
+		name        string
+		contentType string
+		body        string
+		limits      FormLimits
+		err         error
+	}{
+		{"missing boundary", "multipart/form-data", part + "--b--\r\n", DefaultFormLimits, ErrMalformedForm},
+		{"no final boundary", "multipart/form-data; boundary=b", part, DefaultFormLimits, ErrMalformedForm},
+		{"no boundary at all", "multipart/form-data; boundary=b", "just text", DefaultFormLimits, ErrMalformedForm},
+		{"garbage after boundary", "multipart/form-data; boundary=b", "--bx\r\n\r\n--b--", DefaultFormLimits, ErrMalformedForm},
+		{"no disposition", "multipart/form-data; boundary=b", "--b\r\nContent-Type: text/plain\r\n\r\n1\r\n--b--", DefaultFormLimits, ErrMalformedForm},
+		{"bad part header", "multipart/form-data; boundary=b", "--b\r\nno colon\r\n\r\n1\r\n--b--", DefaultFormLimits, ErrMalformedForm},
+		{"too many parts", "multipart/form-data; boundary=b", part + part + part + "--b--", FormLimits{MaxParts: 2}, ErrFormTooLarge},
+		{"too many bytes", "multipart/form-data; boundary=b", part + part + "--b--", FormLimits{MaxBytes: 60}, ErrFormTooLarge},
+		{"part headers too large", "multipart/form-data; boundary=b", part + "--b--", FormLimits{MaxPartHeaderBytes: 20}, ErrFormTooLarge},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := formRequest(t, tt.contentType, tt.body)
+			_, err := r.ParseForm(tt.limits)
+			assert.ErrorIs(t, err, tt.err)
+		})
+	}
+}
+
+func TestParseFormCleansUpOnError(t *testing.T) {
+	dir := t.TempDir()
+	t.Setenv("TMPDIR", dir)
+	body := "--b\r\nContent-Disposition: form-data; name=\"f\"; filename=\"f\"\r\n\r\n" + strings.Repeat("x", 10000)
+	r := formRequest(t, "multipart/form-data; boundary=b", body)
+	_, err := r.ParseForm(FormLimits{MaxMemory: 10})
+	require.ErrorIs(t, err, ErrMalformedForm)
+	entries, err := os.ReadDir(dir)
+	require.NoError(t, err)
+	assert.Empty(t, entries)
+}
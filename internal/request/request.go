@@ -4,7 +4,10 @@ package request
 import (
 	"bytes"
 	"errors"
+	"fmt"
 	"io"
+	"math"
+	"regexp"
 	"strconv"
 	"strings"
 
@@ -15,68 +18,273 @@ type parseState int
 
 const bufferSize = 8
 
-var crlf = []byte("\r\n")
+// bodyBufferSize is the minimum buffer size used once the parser reaches
+// the body, so large bodies are not read a few bytes at a time.
+const bodyBufferSize = 32 << 10
+
+var (
+	crlf         = []byte("\r\n")
+	versionRegex = regexp.MustCompile(`^HTTP/[0-9]\.[0-9]$`)
+)
+
+// maxChunkLineBytes bounds the length of a chunk-size line, including any
+// chunk extensions.
+const maxChunkLineBytes = 4096
+
+var (
+	// ErrMalformedRequestLine is returned for a request line that is not
+	// "METHOD target HTTP/x.y".
+	ErrMalformedRequestLine = errors.New("malformed request line")
+	// ErrUnsupportedVersion is returned for a well-formed HTTP version the
+	// parser does not implement.
+	ErrUnsupportedVersion = errors.New("unsupported HTTP version")
+	// ErrMalformedHeader is returned for an invalid header or trailer field.
+	ErrMalformedHeader = headers.ErrMalformedField
+	// ErrInvalidContentLength is returned when Content-Length is not a
+	// non-negative integer, or is repeated with different values.
+	ErrInvalidContentLength = errors.New("invalid Content-Length")
+	// ErrConflictingFraming is returned for a request carrying both
+	// Content-Length and Transfer-Encoding. Intermediaries may disagree on
+	// which one wins, so such requests are rejected rather than guessed at.
+	ErrConflictingFraming = errors.New("both Content-Length and Transfer-Encoding present")
+	// ErrUnsupportedTransferCoding is returned for a Transfer-Encoding other
+	// than "chunked".
+	ErrUnsupportedTransferCoding = errors.New("unsupported transfer coding")
+	// ErrMalformedChunk is returned for invalid chunked body framing.
+	ErrMalformedChunk = errors.New("malformed chunked body")
+	// ErrRequestLineTooLong is returned when the request line exceeds
+	// Limits.MaxRequestLineBytes.
+	ErrRequestLineTooLong = errors.New("request line too long")
+	// ErrHeaderFieldsTooLarge is returned when the header or trailer block
+	// exceeds Limits.MaxHeaderBytes or Limits.MaxHeaderCount.
+	ErrHeaderFieldsTooLarge = headers.ErrFieldsTooLarge
+	// ErrContentTooLarge is returned when the body exceeds
+	// Limits.MaxBodyBytes.
+	ErrContentTooLarge = errors.New("request body too large")
+)
+
+// Limits bounds the size of requests a Reader accepts. A value of 0 means
+// no limit.
+type Limits struct {
+	MaxRequestLineBytes int
+	MaxHeaderBytes      int
+	MaxHeaderCount      int
+	MaxBodyBytes        int
+}
+
+// DefaultLimits are the limits used by NewReader and RequestFromReader.
+// Bodies are unbounded, since streamed bodies are not held in memory.
+var DefaultLimits = Limits{
+	MaxRequestLineBytes: 8 << 10,
+	MaxHeaderBytes:      1 << 20,
+	MaxHeaderCount:      100,
+}
 
 const (
 	initialized parseState = iota
 	parsingHeaders
 	parsingBody
+	parsingChunkSize
+	parsingChunkData
+	parsingChunkEnd
+	parsingTrailers
 	done
 )
 
 type Request struct {
 	RequestLine RequestLine
 	Headers     *headers.Headers
-	Body        []byte
-	state       parseState
+	// Body holds the full request body. It is left empty for requests read
+	// with ReadRequestHeaders, whose body must be read from BodyReader.
+	Body []byte
+	// BodyReader streams the request body. For fully buffered requests it
+	// reads from Body.
+	BodyReader io.ReadCloser
+	// Trailers holds the trailer fields sent after a chunked body. For
+	// streamed requests they are only available once BodyReader returns
+	// io.EOF.
+	Trailers *headers.Headers
+	state    parseState
+	// chunkLeft is the number of bytes left to read in the current chunk.
+	chunkLeft int
+	// bodyRead is the number of body bytes decoded so far.
+	bodyRead int
+	// streaming makes parse decode body bytes into window, the
+	// destination of the current BodyReader read, instead of Body. At
+	// most bodyLimit bytes fit in the window.
+	streaming bool
+	window    []byte
+	bodyLimit int
+	limits    Limits
+	// pathValues holds the wildcards captured by a router.
+	pathValues map[string]string
+	// form caches the result of ParseForm, as the body can only be read once.
+	form *Form
+	// body is the streamed body reader, kept so DiscardBody still works
+	// after BodyReader has been wrapped or replaced.
+	body *bodyReader
 }
 
 type RequestLine struct {
-	HttpVersion   string
+	HttpVersion string
+	// RequestTarget is the target exactly as sent. Target holds it parsed.
 	RequestTarget string
+	Target        Target
 	Method        string
 }
 
 func RequestFromReader(reader io.Reader) (*Request, error) {
-	r := &Request{
-		state:   initialized,
-		Headers: headers.NewHeaders(),
+	rr := NewReader(reader)
+	r, err := rr.ReadRequest()
+	if err != nil {
+		return nil, err
+	}
+	if r.hasBody() && rr.Buffered() > 0 {
+		return nil, errors.New("body longer than reported Content-Length")
 	}
-	buf := make([]byte, bufferSize)
-	bufLen := 0
+	return r, nil
+}
 
-	for r.state != done {
-		if bufLen == len(buf) {
-			newBuf := make([]byte, len(buf)*2)
-			copy(newBuf, buf)
-			buf = newBuf
-		}
+// Reader reads consecutive requests from a single connection. Bytes read
+// past the end of one request are kept for the next, so pipelined requests
+// are not lost.
+type Reader struct {
+	// Limits applies to each request read after it is set.
+	Limits Limits
+	// ObsFold sets how obsolete line folding in headers and trailers is
+	// handled. The zero value rejects it.
+	ObsFold headers.ObsFoldPolicy
+	reader  io.Reader
+	buf     []byte
+	bufLen  int
+	err     error
+}
+
+func NewReader(reader io.Reader) *Reader {
+	return &Reader{
+		Limits: DefaultLimits,
+		reader: reader,
+		buf:    make([]byte, bufferSize),
+	}
+}
 
-		read, readErr := reader.Read(buf[bufLen:])
-		bufLen += read
+// Buffered returns the number of bytes read from the underlying reader that
+// have not yet been consumed by a request.
+func (rr *Reader) Buffered() int {
+	return rr.bufLen
+}
+
+// Wait blocks until at least one byte of the next request is available, so
+// callers can apply separate deadlines to idle time and to reading the
+// request itself. It returns io.EOF if the connection was closed first.
+func (rr *Reader) Wait() error {
+	if rr.bufLen > 0 {
+		return nil
+	}
+	if rr.err != nil {
+		return rr.err
+	}
+	var read int
+	read, rr.err = rr.reader.Read(rr.buf)
+	rr.bufLen += read
+	if read > 0 {
+		return nil
+	}
+	return rr.err
+}
 
-		parsed, err := r.parse(buf[:bufLen])
+// ReadRequest reads the next request, including its full body. It returns
+// io.EOF if the underlying reader is exhausted before any bytes of a new
+// request have been read.
+func (rr *Reader) ReadRequest() (*Request, error) {
+	r := newRequest(rr.Limits, rr.ObsFold)
+	err := rr.advance(r, func() bool { return r.state == done })
+	if err != nil {
+		return nil, err
+	}
+	r.BodyReader = io.NopCloser(bytes.NewReader(r.Body))
+	return r, nil
+}
+
+// ReadRequestHeaders reads the next request line and headers, leaving the
+// body to be read lazily through the request's BodyReader. The body must be
+// read or discarded before the next request is read.
+func (rr *Reader) ReadRequestHeaders() (*Request, error) {
+	r := newRequest(rr.Limits, rr.ObsFold)
+	r.streaming = true
+	err := rr.advance(r, func() bool { return r.state > parsingHeaders })
+	if err != nil {
+		return nil, err
+	}
+	r.body = &bodyReader{rr: rr, r: r}
+	r.BodyReader = r.body
+	return r, nil
+}
+
+func newRequest(limits Limits, obsFold headers.ObsFoldPolicy) *Request {
+	r := &Request{
+		state:    initialized,
+		Headers:  headers.NewHeaders(),
+		Trailers: headers.NewHeaders(),
+		limits:   limits,
+	}
+	r.Headers.Limit(limits.MaxHeaderBytes, limits.MaxHeaderCount)
+	r.Trailers.Limit(limits.MaxHeaderBytes, limits.MaxHeaderCount)
+	r.Headers.SetObsFoldPolicy(obsFold)
+	r.Trailers.SetObsFoldPolicy(obsFold)
+	return r
+}
+
+// advance parses buffered data into r, reading more from the underlying
+// reader as needed, until reached reports true.
+func (rr *Reader) advance(r *Request, reached func() bool) error {
+	for {
+		parsed, err := r.parse(rr.buf[:rr.bufLen])
 		if err != nil {
-			return nil, err
+			return err
 		}
-		copy(buf, buf[parsed:bufLen])
-		bufLen -= parsed
-
-		// Handle non-EOF errors
-		if readErr != nil {
-			if errors.Is(readErr, io.EOF) {
-				if r.state == parsingBody {
-					return nil, errors.New("body shorter than reported Content-Length")
-				} else {
-					break
-				}
-			} else {
-				return nil, readErr
+		copy(rr.buf, rr.buf[parsed:rr.bufLen])
+		rr.bufLen -= parsed
+
+		if reached() {
+			return nil
+		}
+
+		if rr.err != nil {
+			if !errors.Is(rr.err, io.EOF) {
+				return rr.err
+			}
+			switch {
+			case r.state == initialized && rr.bufLen == 0:
+				return io.EOF
+			case r.state == parsingBody:
+				return errors.New("body shorter than reported Content-Length")
+			case r.state >= parsingChunkSize:
+				return errors.New("chunked body ended before the final chunk")
+			default:
+				return io.ErrUnexpectedEOF
 			}
 		}
+
+		switch {
+		case r.state >= parsingBody && r.state != done && len(rr.buf) < bodyBufferSize:
+			rr.grow(bodyBufferSize)
+		case rr.bufLen == len(rr.buf):
+			rr.grow(len(rr.buf) * 2)
+		}
+
+		var read int
+		read, rr.err = rr.reader.Read(rr.buf[rr.bufLen:])
+		rr.bufLen += read
 	}
+}
 
-	return r, nil
+// grow replaces the buffer with one of the given size, keeping its
+// contents.
+func (rr *Reader) grow(size int) {
+	newBuf := make([]byte, size)
+	copy(newBuf, rr.buf[:rr.bufLen])
+	rr.buf = newBuf
 }
 
 func (r *Request) parse(data []byte) (int, error) {
@@ -89,7 +297,7 @@ loop:
 		}
 		switch r.state {
 		case initialized:
-			rl, n, err := parseRequestLine(curr)
+			rl, n, err := parseRequestLine(curr, r.limits.MaxRequestLineBytes)
 			if err != nil {
 				return 0, err
 			}
@@ -110,7 +318,15 @@ loop:
 			}
 			read += n
 			if doneParsing {
-				if r.hasBody() {
+				if err := r.validateFraming(); err != nil {
+					return 0, err
+				}
+				if limit := r.limits.MaxBodyBytes; limit > 0 && r.getContentLength() > limit {
+					return 0, ErrContentTooLarge
+				}
+				if r.isChunked() {
+					r.state = parsingChunkSize
+				} else if r.hasBody() {
 					r.state = parsingBody
 				} else {
 					r.state = done
@@ -118,14 +334,71 @@ loop:
 			}
 
 		case parsingBody:
-			cl := r.getContentLength()
-			bodyDataLen := len(curr)
-			read += bodyDataLen
-			r.Body = append(r.Body, curr...)
-			bodyLen := len(r.Body)
-			if bodyLen > cl {
-				return 0, errors.New("body longer than reported Content-Length")
-			} else if bodyLen == cl {
+			// Anything past Content-Length belongs to the next request
+			remaining := r.getContentLength() - r.bodyRead
+			n := min(len(curr), remaining, r.bodyRoom())
+			if n == 0 {
+				break loop
+			}
+			read += n
+			r.appendBody(curr[:n])
+			r.bodyRead += n
+			if r.bodyRead == r.getContentLength() {
+				r.state = done
+			}
+
+		case parsingChunkSize:
+			size, n, err := parseChunkSize(curr)
+			if err != nil {
+				return 0, err
+			}
+			if n == 0 {
+				break loop
+			}
+			read += n
+			if limit := r.limits.MaxBodyBytes; limit > 0 && r.bodyRead+size > limit {
+				return 0, ErrContentTooLarge
+			}
+			if size == 0 {
+				r.state = parsingTrailers
+			} else {
+				r.chunkLeft = size
+				r.state = parsingChunkData
+			}
+
+		case parsingChunkData:
+			n := min(len(curr), r.chunkLeft, r.bodyRoom())
+			if n == 0 {
+				break loop
+			}
+			read += n
+			r.appendBody(curr[:n])
+			r.bodyRead += n
+			r.chunkLeft -= n
+			if r.chunkLeft == 0 {
+				r.state = parsingChunkEnd
+			}
+
+		case parsingChunkEnd:
+			if len(curr) < len(crlf) {
+				break loop
+			}
+			if !bytes.HasPrefix(curr, crlf) {
+				return 0, fmt.Errorf("%w: chunk data not terminated by CRLF", ErrMalformedChunk)
+			}
+			read += len(crlf)
+			r.state = parsingChunkSize
+
+		case parsingTrailers:
+			n, doneParsing, err := r.Trailers.Parse(curr)
+			if err != nil {
+				return 0, err
+			}
+			if n == 0 {
+				break loop
+			}
+			read += n
+			if doneParsing {
 				r.state = done
 			}
 
@@ -139,49 +412,233 @@ loop:
 	return read, nil
 }
 
-func parseRequestLine(b []byte) (*RequestLine, int, error) {
-	i := bytes.Index(b, crlf)
+func parseRequestLine(b []byte, maxLen int) (*RequestLine, int, error) {
+	i, ok := findCRLF(b)
+	if !ok {
+		return nil, 0, fmt.Errorf("%w: line not terminated by CRLF", ErrMalformedRequestLine)
+	}
+	if maxLen > 0 && (i > maxLen || i == -1 && len(b) > maxLen) {
+		return nil, 0, ErrRequestLineTooLong
+	}
 	if i == -1 {
 		return nil, 0, nil
 	}
 
 	header := b[:i]
 	read := i + len(crlf)
+	if bytes.IndexByte(header, '\r') != -1 {
+		return nil, 0, fmt.Errorf("%w: bare CR", ErrMalformedRequestLine)
+	}
 
 	parts := strings.Split(string(header), " ")
 	if len(parts) != 3 {
-		return nil, 0, errors.New("request line must have exactly 3 parts")
+		return nil, 0, fmt.Errorf("%w: request line must have exactly 3 parts", ErrMalformedRequestLine)
 	}
 
 	m, t, v := parts[0], parts[1], parts[2]
-	if v != "HTTP/1.1" {
-		return nil, 0, errors.New("HTTP version must be 'HTTP/1.1'")
+	if !versionRegex.MatchString(v) {
+		return nil, 0, fmt.Errorf("%w: invalid HTTP version %q", ErrMalformedRequestLine, v)
+	}
+	if v != "HTTP/1.1" && v != "HTTP/1.0" {
+		return nil, 0, fmt.Errorf("%w: HTTP version must be 'HTTP/1.1' or 'HTTP/1.0'", ErrUnsupportedVersion)
 	}
 	v = strings.TrimPrefix(v, "HTTP/")
 
 	if m != strings.ToUpper(m) {
-		return nil, 0, errors.New("HTTP method must be uppercase")
+		return nil, 0, fmt.Errorf("%w: HTTP method must be uppercase", ErrMalformedRequestLine)
+	}
+
+	target, err := parseTarget(m, t)
+	if err != nil {
+		return nil, 0, err
 	}
 
 	return &RequestLine{
 		HttpVersion:   v,
 		RequestTarget: t,
+		Target:        target,
 		Method:        m,
 	}, read, nil
 }
 
+// bodyRoom returns how many more body bytes parse may decode.
+func (r *Request) bodyRoom() int {
+	if !r.streaming {
+		return math.MaxInt
+	}
+	return r.bodyLimit - len(r.window)
+}
+
+// appendBody adds decoded body bytes to Body, or to the read window when
+// streaming.
+func (r *Request) appendBody(b []byte) {
+	if r.streaming {
+		r.window = append(r.window, b...)
+	} else {
+		r.Body = append(r.Body, b...)
+	}
+}
+
+// parseChunkSize parses a chunk-size line, discarding any chunk extensions.
+// It returns 0 bytes read if the line is incomplete.
+func parseChunkSize(b []byte) (size int, n int, err error) {
+	i, ok := findCRLF(b)
+	if !ok {
+		return 0, 0, fmt.Errorf("%w: chunk size line not terminated by CRLF", ErrMalformedChunk)
+	}
+	if i > maxChunkLineBytes || i == -1 && len(b) > maxChunkLineBytes {
+		return 0, 0, fmt.Errorf("%w: chunk size line too long", ErrMalformedChunk)
+	}
+	if i == -1 {
+		return 0, 0, nil
+	}
+	line := b[:i]
+	if bytes.IndexByte(line, '\r') != -1 {
+		return 0, 0, fmt.Errorf("%w: bare CR in chunk size line", ErrMalformedChunk)
+	}
+	if j := bytes.IndexByte(line, ';'); j != -1 {
+		line = line[:j]
+	}
+	line = bytes.TrimRight(line, " \t")
+	if len(line) == 0 {
+		return 0, 0, fmt.Errorf("%w: missing chunk size", ErrMalformedChunk)
+	}
+	s, err := strconv.ParseUint(string(line), 16, 31)
+	if err != nil {
+		return 0, 0, fmt.Errorf("%w: invalid chunk size", ErrMalformedChunk)
+	}
+	return int(s), i + len(crlf), nil
+}
+
 func (r Request) hasBody() bool {
-	return r.getContentLength() > 0
+	return r.isChunked() || r.getContentLength() > 0
+}
+
+// isChunked reports whether the body uses the chunked transfer coding. Once
+// validateFraming has passed, chunked is the only coding Transfer-Encoding
+// can hold.
+func (r Request) isChunked() bool {
+	return len(r.Headers.Values("Transfer-Encoding")) > 0
+}
+
+// validateFraming checks the headers that determine where the body ends.
+// Anything another parser could read differently is rejected, so that a
+// proxy in front of the server cannot be made to disagree with it about
+// where one request ends and the next begins.
+func (r Request) validateFraming() error {
+	te := r.Headers.Values("Transfer-Encoding")
+	cl := r.Headers.Values("Content-Length")
+	if len(te) > 0 && len(cl) > 0 {
+		return ErrConflictingFraming
+	}
+	if len(te) > 0 && r.RequestLine.HttpVersion == "1.0" {
+		// HTTP/1.0 has no transfer codings, so a proxy may ignore the header
+		return fmt.Errorf("%w: Transfer-Encoding in an HTTP/1.0 request", ErrMalformedHeader)
+	}
+	if len(te) > 0 {
+		return validateTransferEncoding(te)
+	}
+	return validateContentLength(cl)
+}
+
+// validateTransferEncoding checks that the codings listed in the
+// Transfer-Encoding values are exactly "chunked", the only one supported.
+func validateTransferEncoding(values []string) error {
+	codings := listTokens(values)
+	for _, c := range codings {
+		if !strings.EqualFold(c, "chunked") {
+			return fmt.Errorf("%w: %q", ErrUnsupportedTransferCoding, c)
+		}
+	}
+	if len(codings) != 1 {
+		return fmt.Errorf("%w: chunked must be applied exactly once", ErrMalformedHeader)
+	}
+	return nil
+}
+
+// validateContentLength checks that Content-Length, if present, is a
+// non-negative decimal integer. Repeated values, whether in separate fields
+// or as a list, must all be the same.
+func validateContentLength(values []string) error {
+	lengths := listTokens(values)
+	for _, l := range lengths {
+		if l == "" || strings.Trim(l, "0123456789") != "" {
+			return fmt.Errorf("%w: %q", ErrInvalidContentLength, l)
+		}
+		if _, err := strconv.Atoi(l); err != nil {
+			return fmt.Errorf("%w: %q", ErrInvalidContentLength, l)
+		}
+		if l != lengths[0] {
+			return fmt.Errorf("%w: conflicting values %q and %q", ErrInvalidContentLength, lengths[0], l)
+		}
+	}
+	return nil
 }
 
 func (r Request) getContentLength() int {
-	clheader := r.Headers.Get("Content-Length")
-	if clheader == "" {
+	lengths := listTokens(r.Headers.Values("Content-Length"))
+	if len(lengths) == 0 {
 		return 0
 	}
-	cl, err := strconv.Atoi(clheader)
+	cl, err := strconv.Atoi(lengths[0])
 	if err != nil {
 		return 0
 	}
 	return cl
 }
+
+// listTokens splits comma-separated header values into their elements,
+// trimming whitespace. Empty elements are kept so callers can reject them.
+func listTokens(values []string) []string {
+	var tokens []string
+	for _, v := range values {
+		for t := range strings.SplitSeq(v, ",") {
+			tokens = append(tokens, strings.TrimSpace(t))
+		}
+	}
+	return tokens
+}
+
+// findCRLF returns the index of the first CRLF in b, or -1 if b holds no
+// complete line yet. It returns false if a bare LF comes first: some
+// parsers treat it as a line ending and others do not, which is enough to
+// smuggle a request past a proxy.
+func findCRLF(b []byte) (int, bool) {
+	i := bytes.Index(b, crlf)
+	j := bytes.IndexByte(b, '\n')
+	if j != -1 && (i == -1 || j < i) {
+		return -1, false
+	}
+	return i, true
+}
+
+// KeepAlive reports whether the client is willing to send further requests
+// on the same connection after this one. HTTP/1.1 connections persist
+// unless the client sends "Connection: close", while HTTP/1.0 ones close
+// unless it sends "Connection: keep-alive".
+func (r Request) KeepAlive() bool {
+	keepAlive := r.RequestLine.HttpVersion != "1.0"
+	for _, opt := range listTokens(r.Headers.Values("Connection")) {
+		switch {
+		case strings.EqualFold(opt, "close"):
+			return false
+		case strings.EqualFold(opt, "keep-alive"):
+			keepAlive = true
+		}
+	}
+	return keepAlive
+}
+
+// PathValue returns the value of the named path wildcard captured when the
+// request was routed, or "" if there is none.
+func (r *Request) PathValue(name string) string {
+	return r.pathValues[name]
+}
+
+// SetPathValue sets the named path wildcard to value.
+func (r *Request) SetPathValue(name, value string) {
+	if r.pathValues == nil {
+		r.pathValues = make(map[string]string)
+	}
+	r.pathValues[name] = value
+}
@@ -2,6 +2,7 @@ package request
 
 import (
 	"io"
+	"strings"
 	"testing"
 
 	"github.com/stretchr/testify/assert"
@@ -12,11 +13,13 @@ type chunkReader struct {
 	data            string
 	numBytesPerRead int
 	pos             int
+	reads           int
 }
 
 // Read reads up to len(p) or numBytesPerRead bytes from the string per call
 // its useful for simulating reading a variable number of bytes per chunk from a network connection
 func (cr *chunkReader) Read(p []byte) (n int, err error) {
+	cr.reads++
 	if cr.pos >= len(cr.data) {
 		return 0, io.EOF
 	}
@@ -52,6 +55,28 @@ func TestRequestLineParse(t *testing.T) {
 	assert.Equal(t, "/coffee", r.RequestLine.RequestTarget)
 	assert.Equal(t, "1.1", r.RequestLine.HttpVersion)
 
+	// Test: HTTP/1.0 request line
+	reader = &chunkReader{
+		data:            "GET /legacy HTTP/1.0\r\n\r\n",
+		numBytesPerRead: 4,
+	}
+	r, err = RequestFromReader(reader)
+	require.NoError(t, err)
+	assert.Equal(t, "/legacy", r.RequestLine.RequestTarget)
+	assert.Equal(t, "1.0", r.RequestLine.HttpVersion)
+
+	// Test: Parsed target
+	reader = &chunkReader{
+		data:            "GET http://localhost:42069/video?x=1 HTTP/1.1\r\n\r\n",
+		numBytesPerRead: 5,
+	}
+	r, err = RequestFromReader(reader)
+	require.NoError(t, err)
+	assert.Equal(t, "http://localhost:42069/video?x=1", r.RequestLine.RequestTarget)
+	assert.Equal(t, AbsoluteForm, r.RequestLine.Target.Form)
+	assert.Equal(t, "/video", r.RequestLine.Target.Path)
+	assert.Equal(t, "1", r.RequestLine.Target.Query().Get("x"))
+
 	// Test: Invalid number of parts in request line
 	reader = &chunkReader{
 		data:            "/coffee HTTP/1.1\r\nHost: localhost:42069\r\nUser-Agent: curl/7.81.0\r\nAccept: */*\r\n\r\n",
@@ -79,7 +104,8 @@ func TestHeadersParse(t *testing.T) {
 	require.NoError(t, err)
 	require.NotNil(t, r)
 	assert.Equal(t, "localhost:42069", r.Headers.Get("Host"))
-	assert.Equal(t, "curl/7.81.0, ThePrimeagen", r.Headers.Get("User-Agent"))
+	assert.Equal(t, "curl/7.81.0", r.Headers.Get("User-Agent"))
+	assert.Equal(t, []string{"curl/7.81.0", "ThePrimeagen"}, r.Headers.Values("User-Agent"))
 	assert.Equal(t, "*/*", r.Headers.Get("Accept"))
 
 	// Test: Malformed Header
@@ -169,3 +195,364 @@ func TestBodyParse(t *testing.T) {
 	_, err = RequestFromReader(reader)
 	assert.Error(t, err)
 }
+
+func TestPipelinedRequests(t *testing.T) {
+	// Test: Second request arrives in the same read as the first body
+	reader := &chunkReader{
+		data: "POST /submit HTTP/1.1\r\n" +
+			"Content-Length: 5\r\n" +
+			"\r\n" +
+			"hello" +
+			"GET /next HTTP/1.1\r\n" +
+			"Connection: close\r\n" +
+			"\r\n",
+		numBytesPerRead: 1024,
+	}
+	rr := NewReader(reader)
+	r, err := rr.ReadRequest()
+	require.NoError(t, err)
+	assert.Equal(t, "/submit", r.RequestLine.RequestTarget)
+	assert.Equal(t, "hello", string(r.Body))
+	assert.True(t, r.KeepAlive())
+
+	r, err = rr.ReadRequest()
+	require.NoError(t, err)
+	assert.Equal(t, "/next", r.RequestLine.RequestTarget)
+	assert.Equal(t, "", string(r.Body))
+	assert.False(t, r.KeepAlive())
+
+	_, err = rr.ReadRequest()
+	assert.ErrorIs(t, err, io.EOF)
+
+	// Test: Many small reads across request boundaries
+	reader = &chunkReader{
+		data: "GET /a HTTP/1.1\r\n\r\n" +
+			"GET /b HTTP/1.1\r\n\r\n" +
+			"GET /c HTTP/1.1\r\n\r\n",
+		numBytesPerRead: 7,
+	}
+	rr = NewReader(reader)
+	for _, target := range []string{"/a", "/b", "/c"} {
+		r, err = rr.ReadRequest()
+		require.NoError(t, err)
+		assert.Equal(t, target, r.RequestLine.RequestTarget)
+	}
+	_, err = rr.ReadRequest()
+	assert.ErrorIs(t, err, io.EOF)
+
+	// Test: Connection closed mid-request
+	reader = &chunkReader{
+		data:            "GET /a HTTP/1.1\r\n\r\nGET /b HTT",
+		numBytesPerRead: 4,
+	}
+	rr = NewReader(reader)
+	_, err = rr.ReadRequest()
+	require.NoError(t, err)
+	_, err = rr.ReadRequest()
+	assert.ErrorIs(t, err, io.ErrUnexpectedEOF)
+}
+
+func TestChunkedBodyParse(t *testing.T) {
+	// Test: Standard chunked body
+	reader := &chunkReader{
+		data: "POST /submit HTTP/1.1\r\n" +
+			"Host: localhost:42069\r\n" +
+			"Transfer-Encoding: chunked\r\n" +
+			"\r\n" +
+			"6\r\n" +
+			"hello \r\n" +
+			"7\r\n" +
+			"world!\n\r\n" +
+			"0\r\n" +
+			"\r\n",
+		numBytesPerRead: 3,
+	}
+	r, err := RequestFromReader(reader)
+	require.NoError(t, err)
+	require.NotNil(t, r)
+	assert.Equal(t, "hello world!\n", string(r.Body))
+
+	// Test: Chunk extensions and hex sizes
+	reader = &chunkReader{
+		data: "POST /submit HTTP/1.1\r\n" +
+			"Transfer-Encoding: chunked\r\n" +
+			"\r\n" +
+			"a;name=value\r\n" +
+			"0123456789\r\n" +
+			"1 ; ext\r\n" +
+			"A\r\n" +
+			"0;last\r\n" +
+			"\r\n",
+		numBytesPerRead: 5,
+	}
+	r, err = RequestFromReader(reader)
+	require.NoError(t, err)
+	assert.Equal(t, "0123456789A", string(r.Body))
+
+	// Test: Trailers
+	reader = &chunkReader{
+		data: "POST /submit HTTP/1.1\r\n" +
+			"Transfer-Encoding: chunked\r\n" +
+			"Trailer: X-Checksum\r\n" +
+			"\r\n" +
+			"3\r\n" +
+			"abc\r\n" +
+			"0\r\n" +
+			"X-Checksum: 900150983cd24fb0\r\n" +
+			"\r\n",
+		numBytesPerRead: 4,
+	}
+	r, err = RequestFromReader(reader)
+	require.NoError(t, err)
+	assert.Equal(t, "abc", string(r.Body))
+	assert.Equal(t, "900150983cd24fb0", r.Trailers.Get("X-Checksum"))
+	assert.Equal(t, "", r.Headers.Get("X-Checksum"))
+
+	// Test: Empty chunked body
+	reader = &chunkReader{
+		data: "POST /submit HTTP/1.1\r\n" +
+			"Transfer-Encoding: chunked\r\n" +
+			"\r\n" +
+			"0\r\n" +
+			"\r\n",
+		numBytesPerRead: 2,
+	}
+	r, err = RequestFromReader(reader)
+	require.NoError(t, err)
+	assert.Equal(t, "", string(r.Body))
+
+	// Test: Invalid chunk size
+	reader = &chunkReader{
+		data: "POST /submit HTTP/1.1\r\n" +
+			"Transfer-Encoding: chunked\r\n" +
+			"\r\n" +
+			"zz\r\n" +
+			"hello\r\n" +
+			"0\r\n" +
+			"\r\n",
+		numBytesPerRead: 8,
+	}
+	_, err = RequestFromReader(reader)
+	assert.Error(t, err)
+
+	// Test: Chunk longer than its size
+	reader = &chunkReader{
+		data: "POST /submit HTTP/1.1\r\n" +
+			"Transfer-Encoding: chunked\r\n" +
+			"\r\n" +
+			"3\r\n" +
+			"hello\r\n" +
+			"0\r\n" +
+			"\r\n",
+		numBytesPerRead: 8,
+	}
+	_, err = RequestFromReader(reader)
+	assert.Error(t, err)
+
+	// Test: Missing final chunk
+	reader = &chunkReader{
+		data: "POST /submit HTTP/1.1\r\n" +
+			"Transfer-Encoding: chunked\r\n" +
+			"\r\n" +
+			"5\r\n" +
+			"hello\r\n",
+		numBytesPerRead: 8,
+	}
+	_, err = RequestFromReader(reader)
+	assert.Error(t, err)
+
+	// Test: Pipelined request after chunked body
+	reader = &chunkReader{
+		data: "POST /submit HTTP/1.1\r\n" +
+			"Transfer-Encoding: chunked\r\n" +
+			"\r\n" +
+			"5\r\n" +
+			"hello\r\n" +
+			"0\r\n" +
+			"\r\n" +
+			"GET /next HTTP/1.1\r\n" +
+			"\r\n",
+		numBytesPerRead: 1024,
+	}
+	rr := NewReader(reader)
+	r, err = rr.ReadRequest()
+	require.NoError(t, err)
+	assert.Equal(t, "hello", string(r.Body))
+	r, err = rr.ReadRequest()
+	require.NoError(t, err)
+	assert.Equal(t, "/next", r.RequestLine.RequestTarget)
+}
+
+func TestLimits(t *testing.T) {
+	limits := Limits{
+		MaxRequestLineBytes: 32,
+		MaxHeaderBytes:      64,
+		MaxHeaderCount:      2,
+		MaxBodyBytes:        8,
+	}
+	read := func(data string) (*Request, error) {
+		rr := NewReader(&chunkReader{data: data, numBytesPerRead: 5})
+		rr.Limits = limits
+		return rr.ReadRequest()
+	}
+
+	// Test: Within limits
+	r, err := read("POST /submit HTTP/1.1\r\n" +
+		"Host: localhost:42069\r\n" +
+		"Content-Length: 8\r\n" +
+		"\r\n" +
+		"12345678")
+	require.NoError(t, err)
+	assert.Equal(t, "12345678", string(r.Body))
+
+	// Test: Request line too long
+	_, err = read("GET /a/very/long/path/that/never/ends HTTP/1.1\r\n\r\n")
+	assert.ErrorIs(t, err, ErrRequestLineTooLong)
+
+	// Test: Unterminated request line
+	_, err = read("GET /aaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaa")
+	assert.ErrorIs(t, err, ErrRequestLineTooLong)
+
+	// Test: Too many headers
+	_, err = read("GET / HTTP/1.1\r\nA: 1\r\nB: 2\r\nC: 3\r\n\r\n")
+	assert.ErrorIs(t, err, ErrHeaderFieldsTooLarge)
+
+	// Test: Header block too large
+	_, err = read("GET / HTTP/1.1\r\n" +
+		"X-Long: aaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaa\r\n\r\n")
+	assert.ErrorIs(t, err, ErrHeaderFieldsTooLarge)
+
+	// Test: Content-Length too large
+	_, err = read("POST / HTTP/1.1\r\nContent-Length: 9\r\n\r\n123456789")
+	assert.ErrorIs(t, err, ErrContentTooLarge)
+
+	// Test: Chunked body too large
+	_, err = read("POST / HTTP/1.1\r\n" +
+		"Transfer-Encoding: chunked\r\n" +
+		"\r\n" +
+		"5\r\n12345\r\n" +
+		"5\r\n67890\r\n" +
+		"0\r\n\r\n")
+	assert.ErrorIs(t, err, ErrContentTooLarge)
+
+	// Test: Chunk size line too long
+	_, err = read("POST / HTTP/1.1\r\n" +
+		"Transfer-Encoding: chunked\r\n" +
+		"\r\n" +
+		"5;" + strings.Repeat("x", maxChunkLineBytes))
+	assert.Error(t, err)
+}
+
+func TestParseErrors(t *testing.T) {
+	tests := []struct {
+		name string
+		data string
+		err  error
+	}{
+		{
+			name: "missing method",
+			data: "/coffee HTTP/1.1\r\n\r\n",
+			err:  ErrMalformedRequestLine,
+		},
+		{
+			name: "lowercase method",
+			data: "get / HTTP/1.1\r\n\r\n",
+			err:  ErrMalformedRequestLine,
+		},
+		{
+			name: "garbage version",
+			data: "GET / HTTP/one\r\n\r\n",
+			err:  ErrMalformedRequestLine,
+		},
+		{
+			name: "Transfer-Encoding in HTTP/1.0",
+			data: "POST / HTTP/1.0\r\nTransfer-Encoding: chunked\r\n\r\n0\r\n\r\n",
+			err:  ErrMalformedHeader,
+		},
+		{
+			name: "unsupported version",
+			data: "GET / HTTP/2.0\r\n\r\n",
+			err:  ErrUnsupportedVersion,
+		},
+		{
+			name: "header without colon",
+			data: "GET / HTTP/1.1\r\nHost localhost\r\n\r\n",
+			err:  ErrMalformedHeader,
+		},
+		{
+			name: "control character in header value",
+			data: "GET / HTTP/1.1\r\nX-Name: a\x00b\r\n\r\n",
+			err:  ErrMalformedHeader,
+		},
+		{
+			name: "bare CR in header value",
+			data: "GET / HTTP/1.1\r\nX-Name: a\rSet-Cookie: b\r\n\r\n",
+			err:  ErrMalformedHeader,
+		},
+		{
+			name: "obsolete line folding",
+			data: "GET / HTTP/1.1\r\nX-Long: a\r\n b\r\n\r\n",
+			err:  ErrMalformedHeader,
+		},
+		{
+			name: "non-numeric Content-Length",
+			data: "POST / HTTP/1.1\r\nContent-Length: abc\r\n\r\n",
+			err:  ErrInvalidContentLength,
+		},
+		{
+			name: "negative Content-Length",
+			data: "POST / HTTP/1.1\r\nContent-Length: -1\r\n\r\n",
+			err:  ErrInvalidContentLength,
+		},
+		{
+			name: "invalid chunk size",
+			data: "POST / HTTP/1.1\r\nTransfer-Encoding: chunked\r\n\r\nxyz\r\n",
+			err:  ErrMalformedChunk,
+		},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			_, err := RequestFromReader(&chunkReader{data: tc.data, numBytesPerRead: 7})
+			assert.ErrorIs(t, err, tc.err)
+		})
+	}
+}
+
+func TestReaderWait(t *testing.T) {
+	// Test: Wait buffers the start of the next request
+	reader := &chunkReader{
+		data:            "GET /a HTTP/1.1\r\n\r\n",
+		numBytesPerRead: 3,
+	}
+	rr := NewReader(reader)
+	require.NoError(t, rr.Wait())
+	assert.Equal(t, 3, rr.Buffered())
+	require.NoError(t, rr.Wait())
+	assert.Equal(t, 3, rr.Buffered())
+	r, err := rr.ReadRequest()
+	require.NoError(t, err)
+	assert.Equal(t, "/a", r.RequestLine.RequestTarget)
+
+	// Test: Wait on a closed connection
+	assert.ErrorIs(t, rr.Wait(), io.EOF)
+}
+
+func TestKeepAlive(t *testing.T) {
+	tests := []struct {
+		data      string
+		keepAlive bool
+	}{
+		{"GET / HTTP/1.1\r\n\r\n", true},
+		{"GET / HTTP/1.1\r\nConnection: close\r\n\r\n", false},
+		{"GET / HTTP/1.1\r\nConnection: Upgrade, Close\r\n\r\n", false},
+		{"GET / HTTP/1.0\r\n\r\n", false},
+		{"GET / HTTP/1.0\r\nConnection: keep-alive\r\n\r\n", true},
+		{"GET / HTTP/1.0\r\nConnection: Keep-Alive\r\n\r\n", true},
+		{"GET / HTTP/1.0\r\nConnection: keep-alive, close\r\n\r\n", false},
+	}
+	for _, tt := range tests {
+		r, err := RequestFromReader(strings.NewReader(tt.data))
+		require.NoError(t, err)
+		assert.Equal(t, tt.keepAlive, r.KeepAlive(), "%q", tt.data)
+	}
+}
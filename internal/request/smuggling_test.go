@@ -0,0 +1,159 @@
+package request
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// TestSmuggling feeds the parser requests modeled on known desync attacks,
+// where a front-end proxy and a back-end server disagree on where a request
+// ends. Each must either be rejected outright or parse the same way any
+// conforming parser would.
+func TestSmuggling(t *testing.T) {
+	tests := []struct {
+		name string
+		data string
+		err  error
+	}{
+		{
+			name: "CL.TE",
+			data: "POST / HTTP/1.1\r\nHost: a\r\nContent-Length: 13\r\nTransfer-Encoding: chunked\r\n\r\n0\r\n\r\nSMUGGLED",
+			err:  ErrConflictingFraming,
+		},
+		{
+			name: "TE.CL",
+			data: "POST / HTTP/1.1\r\nHost: a\r\nTransfer-Encoding: chunked\r\nContent-Length: 3\r\n\r\n8\r\nSMUGGLED\r\n0\r\n\r\n",
+			err:  ErrConflictingFraming,
+		},
+		{
+			name: "TE.TE obfuscated coding",
+			data: "POST / HTTP/1.1\r\nHost: a\r\nTransfer-Encoding: chunked\r\nTransfer-Encoding: x\r\n\r\n0\r\n\r\n",
+			err:  ErrUnsupportedTransferCoding,
+		},
+		{
+			name: "TE.TE quoted coding",
+			data: "POST / HTTP/1.1\r\nHost: a\r\nTransfer-Encoding: \"chunked\"\r\n\r\n0\r\n\r\n",
+			err:  ErrUnsupportedTransferCoding,
+		},
+		{
+			name: "TE.TE chunked not last",
+			data: "POST / HTTP/1.1\r\nHost: a\r\nTransfer-Encoding: chunked, identity\r\n\r\n0\r\n\r\n",
+			err:  ErrUnsupportedTransferCoding,
+		},
+		{
+			name: "TE.TE chunked twice",
+			data: "POST / HTTP/1.1\r\nHost: a\r\nTransfer-Encoding: chunked, chunked\r\n\r\n0\r\n\r\n",
+			err:  ErrMalformedHeader,
+		},
+		{
+			name: "TE.TE empty element",
+			data: "POST / HTTP/1.1\r\nHost: a\r\nTransfer-Encoding: chunked,\r\n\r\n0\r\n\r\n",
+			err:  ErrUnsupportedTransferCoding,
+		},
+		{
+			name: "TE with whitespace before colon",
+			data: "POST / HTTP/1.1\r\nHost: a\r\nTransfer-Encoding : chunked\r\n\r\n0\r\n\r\n",
+			err:  ErrMalformedHeader,
+		},
+		{
+			name: "TE with tab before colon",
+			data: "POST / HTTP/1.1\r\nHost: a\r\nTransfer-Encoding\t: chunked\r\n\r\n0\r\n\r\n",
+			err:  ErrMalformedHeader,
+		},
+		{
+			name: "TE hidden by obs-fold",
+			data: "POST / HTTP/1.1\r\nHost: a\r\nX: y\r\n Transfer-Encoding: chunked\r\n\r\n0\r\n\r\n",
+			err:  ErrMalformedHeader,
+		},
+		{
+			name: "TE hidden by bare LF",
+			data: "POST / HTTP/1.1\r\nHost: a\r\nX: y\nTransfer-Encoding: chunked\r\nContent-Length: 4\r\n\r\n0\r\n\r\n",
+			err:  ErrMalformedHeader,
+		},
+		{
+			name: "CL.CL conflicting fields",
+			data: "POST / HTTP/1.1\r\nHost: a\r\nContent-Length: 5\r\nContent-Length: 10\r\n\r\nhelloGET / HTTP/1.1\r\n\r\n",
+			err:  ErrInvalidContentLength,
+		},
+		{
+			name: "CL.CL conflicting list",
+			data: "POST / HTTP/1.1\r\nHost: a\r\nContent-Length: 5, 10\r\n\r\nhelloGET / HTTP/1.1\r\n\r\n",
+			err:  ErrInvalidContentLength,
+		},
+		{
+			name: "CL with sign",
+			data: "POST / HTTP/1.1\r\nHost: a\r\nContent-Length: +5\r\n\r\nhello",
+			err:  ErrInvalidContentLength,
+		},
+		{
+			name: "CL empty",
+			data: "POST / HTTP/1.1\r\nHost: a\r\nContent-Length:\r\n\r\n",
+			err:  ErrInvalidContentLength,
+		},
+		{
+			name: "bare LF request line",
+			data: "GET / HTTP/1.1\nHost: a\r\n\r\n",
+			err:  ErrMalformedRequestLine,
+		},
+		{
+			name: "bare LF in request target",
+			data: "GET /a\nb HTTP/1.1\r\nHost: a\r\n\r\n",
+			err:  ErrMalformedRequestLine,
+		},
+		{
+			name: "bare CR in request line",
+			data: "GET /a\rb HTTP/1.1\r\nHost: a\r\n\r\n",
+			err:  ErrMalformedRequestLine,
+		},
+		{
+			name: "bare LF ends header block",
+			data: "GET / HTTP/1.1\r\nHost: a\r\n\n",
+			err:  ErrMalformedHeader,
+		},
+		{
+			name: "bare LF after chunk size",
+			data: "POST / HTTP/1.1\r\nHost: a\r\nTransfer-Encoding: chunked\r\n\r\n5\nhello\r\n0\r\n\r\n",
+			err:  ErrMalformedChunk,
+		},
+		{
+			name: "bare LF in chunk extension",
+			data: "POST / HTTP/1.1\r\nHost: a\r\nTransfer-Encoding: chunked\r\n\r\n5;a\nhello\r\n0\r\n\r\n",
+			err:  ErrMalformedChunk,
+		},
+		{
+			name: "bare LF after chunk data",
+			data: "POST / HTTP/1.1\r\nHost: a\r\nTransfer-Encoding: chunked\r\n\r\n5\r\nhello\n0\r\n\r\n",
+			err:  ErrMalformedChunk,
+		},
+		{
+			name: "oversized chunk size",
+			data: "POST / HTTP/1.1\r\nHost: a\r\nTransfer-Encoding: chunked\r\n\r\nffffffffffffffff1\r\nhello\r\n0\r\n\r\n",
+			err:  ErrMalformedChunk,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := RequestFromReader(&chunkReader{data: tt.data, numBytesPerRead: 3})
+			assert.ErrorIs(t, err, tt.err)
+		})
+	}
+}
+
+func TestRepeatedContentLength(t *testing.T) {
+	// Identical values are one length, as RFC 9110 allows
+	for _, h := range []string{"Content-Length: 5\r\nContent-Length: 5\r\n", "Content-Length: 5, 5\r\n"} {
+		data := "POST / HTTP/1.1\r\nHost: a\r\n" + h + "\r\nhello"
+		r, err := NewReader(strings.NewReader(data)).ReadRequest()
+		require.NoError(t, err)
+		assert.Equal(t, "hello", string(r.Body))
+	}
+
+	// Case-insensitive chunked
+	data := "POST / HTTP/1.1\r\nHost: a\r\nTransfer-Encoding: Chunked\r\n\r\n5\r\nhello\r\n0\r\n\r\n"
+	r, err := RequestFromReader(strings.NewReader(data))
+	require.NoError(t, err)
+	assert.Equal(t, "hello", string(r.Body))
+}
@@ -0,0 +1,256 @@
+package request
+
+import (
+	"fmt"
+	"strings"
+)
+
+// TargetForm is one of the four forms of request target defined by RFC
+// 9112.
+type TargetForm int
+
+const (
+	// OriginForm is an absolute path with an optional query, e.g.
+	// "/video?x=1". It is used for most requests.
+	OriginForm TargetForm = iota
+	// AbsoluteForm is a full URL, e.g. "http://example.com/video", as sent
+	// to proxies.
+	AbsoluteForm
+	// AuthorityForm is a host and port, e.g. "example.com:443", used only
+	// by CONNECT.
+	AuthorityForm
+	// AsteriskForm is "*", used only by a server-wide OPTIONS request.
+	AsteriskForm
+)
+
+// Target is a parsed request target.
+type Target struct {
+	Form TargetForm
+	// Scheme is set for absolute-form targets, e.g. "http".
+	Scheme string
+	// Authority is the host and optional port of absolute-form and
+	// authority-form targets.
+	Authority string
+	// Path is the percent-decoded path. It is "/" for an absolute-form
+	// target without one, and empty for authority-form and asterisk-form.
+	Path string
+	// RawPath is the path as sent, still percent-encoded.
+	RawPath string
+	// RawQuery is the query without the leading "?", still percent-encoded.
+	RawQuery string
+}
+
+// Query returns the decoded query parameters.
+func (t Target) Query() Query {
+	// Escapes were validated when the target was parsed
+	q, _ := parseQuery(t.RawQuery)
+	return q
+}
+
+// Query holds decoded query parameters. A key may appear several times.
+type Query map[string][]string
+
+// Get returns the first value for key, or "" if there is none.
+func (q Query) Get(key string) string {
+	if v := q[key]; len(v) > 0 {
+		return v[0]
+	}
+	return ""
+}
+
+// Has reports whether key is present, even with an empty value.
+func (q Query) Has(key string) bool {
+	_, ok := q[key]
+	return ok
+}
+
+// parseQuery decodes "&"-separated key=value pairs, where "+" stands for a
+// space. It returns false if a percent-encoding is invalid.
+func parseQuery(raw string) (Query, bool) {
+	q := make(Query)
+	for pair := range strings.SplitSeq(raw, "&") {
+		if pair == "" {
+			continue
+		}
+		k, v, _ := strings.Cut(pair, "=")
+		k, ok := unescape(strings.ReplaceAll(k, "+", " "))
+		if !ok {
+			return nil, false
+		}
+		v, ok = unescape(strings.ReplaceAll(v, "+", " "))
+		if !ok {
+			return nil, false
+		}
+		q[k] = append(q[k], v)
+	}
+	return q, true
+}
+
+// parseTarget parses the request target of a request with the given
+// method, rejecting forms the method does not allow and characters RFC 3986
+// does not allow.
+func parseTarget(method, raw string) (Target, error) {
+	switch {
+	case method == "CONNECT":
+		return parseAuthorityForm(raw)
+	case raw == "*":
+		if method != "OPTIONS" {
+			return Target{}, fmt.Errorf("%w: %q target is only allowed for OPTIONS", ErrMalformedRequestLine, raw)
+		}
+		return Target{Form: AsteriskForm}, nil
+	case strings.HasPrefix(raw, "/"):
+		t := Target{Form: OriginForm}
+		return t, t.setPathAndQuery(raw)
+	default:
+		return parseAbsoluteForm(raw)
+	}
+}
+
+func parseAuthorityForm(raw string) (Target, error) {
+	i := strings.LastIndexByte(raw, ':')
+	if i <= 0 || i == len(raw)-1 || strings.Trim(raw[i+1:], "0123456789") != "" {
+		return Target{}, fmt.Errorf("%w: CONNECT target must be host:port", ErrMalformedRequestLine)
+	}
+	if err := validateAuthority(raw); err != nil {
+		return Target{}, err
+	}
+	return Target{Form: AuthorityForm, Authority: raw}, nil
+}
+
+func parseAbsoluteForm(raw string) (Target, error) {
+	scheme, rest, ok := strings.Cut(raw, "://")
+	if !ok || !validScheme(scheme) {
+		return Target{}, fmt.Errorf("%w: invalid request target %q", ErrMalformedRequestLine, raw)
+	}
+	end := strings.IndexAny(rest, "/?")
+	if end == -1 {
+		end = len(rest)
+	}
+	authority := rest[:end]
+	if authority == "" {
+		return Target{}, fmt.Errorf("%w: missing host in %q", ErrMalformedRequestLine, raw)
+	}
+	if err := validateAuthority(authority); err != nil {
+		return Target{}, err
+	}
+	t := Target{
+		Form:      AbsoluteForm,
+		Scheme:    strings.ToLower(scheme),
+		Authority: authority,
+	}
+	pathAndQuery := rest[end:]
+	if !strings.HasPrefix(pathAndQuery, "/") {
+		pathAndQuery = "/" + pathAndQuery
+	}
+	return t, t.setPathAndQuery(pathAndQuery)
+}
+
+// setPathAndQuery splits, validates and decodes "path?query".
+func (t *Target) setPathAndQuery(s string) error {
+	rawPath, rawQuery, _ := strings.Cut(s, "?")
+	for i := 0; i < len(rawPath); i++ {
+		if !isPathChar(rawPath[i]) {
+			return fmt.Errorf("%w: invalid character %q in path", ErrMalformedRequestLine, rawPath[i])
+		}
+	}
+	for i := 0; i < len(rawQuery); i++ {
+		if c := rawQuery[i]; !isPathChar(c) && c != '?' {
+			return fmt.Errorf("%w: invalid character %q in query", ErrMalformedRequestLine, c)
+		}
+	}
+	path, ok := unescape(rawPath)
+	if !ok {
+		return fmt.Errorf("%w: invalid percent-encoding in path", ErrMalformedRequestLine)
+	}
+	if _, ok := unescape(rawQuery); !ok {
+		return fmt.Errorf("%w: invalid percent-encoding in query", ErrMalformedRequestLine)
+	}
+	t.Path, t.RawPath, t.RawQuery = path, rawPath, rawQuery
+	return nil
+}
+
+func validScheme(s string) bool {
+	if s == "" || !isAlpha(s[0]) {
+		return false
+	}
+	for i := 1; i < len(s); i++ {
+		if c := s[i]; !isAlpha(c) && !isDigit(c) && c != '+' && c != '-' && c != '.' {
+			return false
+		}
+	}
+	return true
+}
+
+// validateAuthority checks a host and optional port. User information is
+// rejected, as RFC 9110 forbids it in http and https URLs.
+func validateAuthority(s string) error {
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		if !isUnreserved(c) && !isSubDelim(c) && c != ':' && c != '[' && c != ']' && c != '%' {
+			return fmt.Errorf("%w: invalid character %q in authority", ErrMalformedRequestLine, c)
+		}
+	}
+	if _, ok := unescape(s); !ok {
+		return fmt.Errorf("%w: invalid percent-encoding in authority", ErrMalformedRequestLine)
+	}
+	return nil
+}
+
+// unescape decodes percent-encoded octets in s. It returns false if a "%"
+// is not followed by two hex digits.
+func unescape(s string) (string, bool) {
+	if !strings.Contains(s, "%") {
+		return s, true
+	}
+	var b strings.Builder
+	b.Grow(len(s))
+	for i := 0; i < len(s); i++ {
+		if s[i] != '%' {
+			b.WriteByte(s[i])
+			continue
+		}
+		if i+2 >= len(s) || !isHex(s[i+1]) || !isHex(s[i+2]) {
+			return "", false
+		}
+		b.WriteByte(unhex(s[i+1])<<4 | unhex(s[i+2]))
+		i += 2
+	}
+	return b.String(), true
+}
+
+// isPathChar reports whether c may appear in a path: a pchar or "/", where
+// "%" starts a percent-encoded octet.
+func isPathChar(c byte) bool {
+	return isUnreserved(c) || isSubDelim(c) || strings.IndexByte(":@/%", c) != -1
+}
+
+func isUnreserved(c byte) bool {
+	return isAlpha(c) || isDigit(c) || strings.IndexByte("-._~", c) != -1
+}
+
+func isSubDelim(c byte) bool {
+	return strings.IndexByte("!$&'()*+,;=", c) != -1
+}
+
+func isAlpha(c byte) bool {
+	return 'a' <= c && c <= 'z' || 'A' <= c && c <= 'Z'
+}
+
+func isDigit(c byte) bool {
+	return '0' <= c && c <= '9'
+}
+
+func isHex(c byte) bool {
+	return isDigit(c) || 'a' <= c && c <= 'f' || 'A' <= c && c <= 'F'
+}
+
+func unhex(c byte) byte {
+	switch {
+	case isDigit(c):
+		return c - '0'
+	case 'a' <= c && c <= 'f':
+		return c - 'a' + 10
+	default:
+		return c - 'A' + 10
+	}
+}
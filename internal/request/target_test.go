@@ -0,0 +1,80 @@
+package request
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseTarget(t *testing.T) {
+	tests := []struct {
+		method string
+		raw    string
+		want   Target
+	}{
+		{"GET", "/", Target{Form: OriginForm, Path: "/", RawPath: "/"}},
+		{"GET", "/video?x=1", Target{Form: OriginForm, Path: "/video", RawPath: "/video", RawQuery: "x=1"}},
+		{"GET", "/a%20b/c%2Fd?q=%26", Target{Form: OriginForm, Path: "/a b/c/d", RawPath: "/a%20b/c%2Fd", RawQuery: "q=%26"}},
+		{"GET", "/search?q=a?b/c", Target{Form: OriginForm, Path: "/search", RawPath: "/search", RawQuery: "q=a?b/c"}},
+		{"GET", "http://example.com:8080/video?x=1", Target{
+			Form: AbsoluteForm, Scheme: "http", Authority: "example.com:8080",
+			Path: "/video", RawPath: "/video", RawQuery: "x=1",
+		}},
+		{"GET", "HTTP://example.com", Target{Form: AbsoluteForm, Scheme: "http", Authority: "example.com", Path: "/", RawPath: "/"}},
+		{"GET", "http://[::1]?x", Target{Form: AbsoluteForm, Scheme: "http", Authority: "[::1]", Path: "/", RawPath: "/", RawQuery: "x"}},
+		{"CONNECT", "example.com:443", Target{Form: AuthorityForm, Authority: "example.com:443"}},
+		{"OPTIONS", "*", Target{Form: AsteriskForm}},
+	}
+	for _, tt := range tests {
+		got, err := parseTarget(tt.method, tt.raw)
+		require.NoError(t, err, tt.raw)
+		assert.Equal(t, tt.want, got, tt.raw)
+	}
+}
+
+func TestParseTargetErrors(t *testing.T) {
+	tests := []struct {
+		method string
+		raw    string
+	}{
+		{"GET", "video"},
+		{"GET", "/a b"},
+		{"GET", "/a<b>"},
+		{"GET", "/a\"b"},
+		{"GET", "/a#frag"},
+		{"GET", "/caf\xc3\xa9"},
+		{"GET", "/a%2"},
+		{"GET", "/a%zz"},
+		{"GET", "/?q=%g0"},
+		{"GET", "/?q={}"},
+		{"GET", "*"},
+		{"GET", "http:///path"},
+		{"GET", "http://user@example.com/"},
+		{"GET", "1http://example.com/"},
+		{"CONNECT", "/"},
+		{"CONNECT", "example.com"},
+		{"CONNECT", "example.com:https"},
+		{"CONNECT", ":443"},
+	}
+	for _, tt := range tests {
+		_, err := parseTarget(tt.method, tt.raw)
+		assert.ErrorIs(t, err, ErrMalformedRequestLine, "%s %q", tt.method, tt.raw)
+	}
+}
+
+func TestQuery(t *testing.T) {
+	target, err := parseTarget("GET", "/?a=1&b=x+y&a=2&c&d=&e=%3D%26&&f%20g=h")
+	require.NoError(t, err)
+	q := target.Query()
+	assert.Equal(t, "1", q.Get("a"))
+	assert.Equal(t, []string{"1", "2"}, q["a"])
+	assert.Equal(t, "x y", q.Get("b"))
+	assert.True(t, q.Has("c"))
+	assert.True(t, q.Has("d"))
+	assert.Equal(t, "", q.Get("d"))
+	assert.Equal(t, "=&", q.Get("e"))
+	assert.Equal(t, "h", q.Get("f g"))
+	assert.False(t, q.Has("missing"))
+	assert.Empty(t, Target{}.Query())
+}
@@ -2,35 +2,132 @@
 package response
 
 import (
+	"errors"
 	"fmt"
 	"io"
+	"slices"
 	"strconv"
 	"strings"
 
 	"github.com/austin-weeks/http-from-scratch/internal/headers"
-	"golang.org/x/text/cases"
-	"golang.org/x/text/language"
 )
 
 func GetDefaultHeaders(contentLength int) *headers.Headers {
 	h := headers.NewHeaders()
 	h.Set("Content-Length", fmt.Sprint(contentLength))
 	h.Set("Content-Type", "text/plain")
-	h.Set("Connection", "close")
 
 	return h
 }
 
-type StatusCode int
+// ErrWriteOrder is returned when a Writer method is called out of order,
+// e.g. writing headers twice or a chunk after the final one.
+var ErrWriteOrder = errors.New("response written out of order")
+
+// ErrBodyLength is returned when a body does not match the Content-Length
+// the handler declared. Bytes past it are not sent.
+var ErrBodyLength = errors.New("body does not match Content-Length")
+
+// ErrInvalidTrailer is returned when declaring a trailer field that may not
+// be sent as a trailer, or setting one that was not declared.
+var ErrInvalidTrailer = errors.New("invalid trailer field")
+
+// forbiddenTrailers are fields a sender must not put in a trailer section,
+// because they control framing, routing, authentication or how the content
+// is processed (RFC 9110, section 6.5.1).
+var forbiddenTrailers = map[string]bool{
+	"age":                 true,
+	"authorization":       true,
+	"cache-control":       true,
+	"connection":          true,
+	"content-encoding":    true,
+	"content-length":      true,
+	"content-range":       true,
+	"content-type":        true,
+	"date":                true,
+	"expect":              true,
+	"expires":             true,
+	"host":                true,
+	"if-match":            true,
+	"if-modified-since":   true,
+	"if-none-match":       true,
+	"if-range":            true,
+	"if-unmodified-since": true,
+	"location":            true,
+	"max-forwards":        true,
+	"pragma":              true,
+	"proxy-authenticate":  true,
+	"proxy-authorization": true,
+	"range":               true,
+	"retry-after":         true,
+	"set-cookie":          true,
+	"te":                  true,
+	"trailer":             true,
+	"transfer-encoding":   true,
+	"vary":                true,
+	"www-authenticate":    true,
+}
+
+// ErrBodyNotAllowed is returned when writing a body for a status code that
+// cannot have one.
+var ErrBodyNotAllowed = errors.New("response status does not allow a body")
+
+// bufferSize is how much of a body without explicit framing is buffered
+// before the writer switches to chunked encoding.
+const bufferSize = 4 << 10
+
+type writerState int
 
 const (
-	StatusOK            StatusCode = 200
-	StatusBadRequest    StatusCode = 400
-	StatusInternalError StatusCode = 500
+	writingStatus writerState = iota
+	writingHeaders
+	// bufferingBody means headers without framing were given and the body
+	// is being buffered to compute Content-Length.
+	bufferingBody
+	writingBody
+	writingChunkedBody
+	responseDone
 )
 
+// Writer writes a response in order: status line, headers, then body. Writing
+// a body implicitly sends a 200 status line and the headers from Header if
+// they have not been written yet. Interim 1xx responses may come before
+// the status line; see WriteInterim.
+//
+// If the headers set neither Content-Length nor Transfer-Encoding, the
+// writer frames the body itself: small bodies are buffered and sent with a
+// Content-Length once the handler is done, while larger ones, or any body
+// once Flush is called, are sent with chunked encoding. Finish must be called
+// after the handler returns to complete the response.
 type Writer struct {
-	conn io.Writer
+	conn      io.Writer
+	state     writerState
+	closeConn bool
+	status    StatusCode
+	bodyBytes int
+	pending   *headers.Headers
+	// contentLength is the Content-Length sent with the headers, if
+	// hasLength is set.
+	contentLength int
+	hasLength     bool
+	// deferred holds headers given to WriteHeaders while buffering the body.
+	deferred *headers.Headers
+	buf      []byte
+	// autoChunked is set when the writer chose chunked encoding itself, so
+	// WriteBody encodes chunks and Finish sends the final one.
+	autoChunked bool
+	omitBody    bool
+	aborted     bool
+	http10      bool
+	// awaitingContinue is set while the client holds back the body until
+	// it gets "100 Continue".
+	awaitingContinue bool
+	// unchunked is set when the handler writes a chunked body to an
+	// HTTP/1.0 client, which cannot decode it, so chunks are sent raw.
+	unchunked bool
+	// trailerNames are the declared trailer fields, spelled as declared.
+	trailerNames []string
+	trailers     *headers.Headers
 }
 
 func NewWriter(connection io.Writer) *Writer {
@@ -39,77 +136,508 @@ func NewWriter(connection io.Writer) *Writer {
 	}
 }
 
+// UseHTTP10 makes the writer respond to an HTTP/1.0 client: the status line
+// carries that version, and since HTTP/1.0 has no chunked encoding, bodies
+// that cannot be sent with a Content-Length are delimited by closing the
+// connection instead. Trailers are dropped. It must be called before
+// anything is written.
+func (w *Writer) UseHTTP10() {
+	w.http10 = true
+}
+
+// OmitBody makes the writer discard the body while still sending the headers
+// that would describe it, as required for responses to HEAD requests.
+func (w *Writer) OmitBody() {
+	w.omitBody = true
+}
+
 func (w *Writer) WriteStatusLine(statusCode StatusCode) error {
-	reason := ""
-	switch statusCode {
-	case StatusOK:
-		reason = "OK"
-	case StatusBadRequest:
-		reason = "Bad Request"
-	case StatusInternalError:
-		reason = "Internal Server Error"
-	}
-	statusLine := fmt.Appendf(nil, "HTTP/1.1 %d %s\r\n", statusCode, reason)
-	for len(statusLine) > 0 {
-		n, err := w.conn.Write(statusLine)
-		if err != nil {
+	if w.state != writingStatus {
+		return fmt.Errorf("%w: status line already written", ErrWriteOrder)
+	}
+	if statusCode < 100 || statusCode > 599 {
+		return fmt.Errorf("%w: %d", ErrInvalidStatus, statusCode)
+	}
+	if statusCode < 200 && statusCode != StatusSwitchingProtocols {
+		return fmt.Errorf("%w: %d is an interim status, use WriteInterim", ErrInvalidStatus, statusCode)
+	}
+	w.state = writingHeaders
+	w.status = statusCode
+	version := "1.1"
+	if w.http10 {
+		version = "1.0"
+	}
+	statusLine := fmt.Appendf(nil, "HTTP/%s %d %s\r\n", version, statusCode, StatusText(statusCode))
+	_, err := w.write(statusLine)
+	return err
+}
+
+// ExpectContinue tells the writer the client sent "Expect: 100-continue"
+// and is holding back the request body. If the final response is sent
+// before WriteContinue, the connection is closed after it, since the body
+// may still be on its way and cannot be told apart from the next request.
+func (w *Writer) ExpectContinue() {
+	w.awaitingContinue = true
+}
+
+// WriteContinue sends a "100 Continue" interim response, telling a client
+// that sent "Expect: 100-continue" to go ahead with the request body. It
+// must be called before the final status line is written.
+func (w *Writer) WriteContinue() error {
+	return w.WriteInterim(StatusContinue, nil)
+}
+
+// WriteInterim sends an informational 1xx response with its own header
+// block, e.g. 103 Early Hints with Link headers the client can preload
+// while the final response is prepared. Any number of interim responses
+// may be sent before the final status line. h may be nil. HTTP/1.0 clients
+// do not understand interim responses, so nothing is sent to them.
+func (w *Writer) WriteInterim(statusCode StatusCode, h *headers.Headers) error {
+	if w.state != writingStatus {
+		return fmt.Errorf("%w: final status already written", ErrWriteOrder)
+	}
+	if statusCode < 100 || statusCode > 199 || statusCode == StatusSwitchingProtocols {
+		return fmt.Errorf("%w: %d is not an interim status", ErrInvalidStatus, statusCode)
+	}
+	if statusCode == StatusContinue {
+		w.awaitingContinue = false
+	}
+	if w.http10 {
+		return nil
+	}
+	p := fmt.Appendf(nil, "HTTP/1.1 %d %s\r\n", statusCode, StatusText(statusCode))
+	if h != nil {
+		h.ForEach(func(k, v string) {
+			p = fmt.Appendf(p, "%s: %s\r\n", k, v)
+		})
+	}
+	p = append(p, []byte("\r\n")...)
+	_, err := w.write(p)
+	return err
+}
+
+// Status returns the status code written so far, or 0 if the status line
+// has not been written.
+func (w *Writer) Status() StatusCode {
+	return w.status
+}
+
+// BodyBytes returns the number of body bytes written so far, excluding
+// chunked encoding framing.
+func (w *Writer) BodyBytes() int {
+	return w.bodyBytes
+}
+
+// Committed reports whether any part of the response has been written, after
+// which the status can no longer be changed.
+func (w *Writer) Committed() bool {
+	return w.state != writingStatus
+}
+
+// Header returns the headers to be sent along with those passed to
+// WriteHeaders, or on their own if the body is written without calling
+// WriteHeaders. This also lets code that wraps a handler add headers of its
+// own. Headers passed to WriteHeaders take precedence.
+func (w *Writer) Header() *headers.Headers {
+	if w.pending == nil {
+		w.pending = headers.NewHeaders()
+	}
+	return w.pending
+}
+
+// CloseAfterResponse marks the connection to be closed once this response
+// has been written. A "Connection: close" header is added to the response if
+// the handler does not set one itself.
+func (w *Writer) CloseAfterResponse() {
+	w.closeConn = true
+}
+
+// Abort marks the response as incomplete, e.g. because the handler failed
+// after starting it. Finish then sends nothing more and the connection must
+// be closed.
+func (w *Writer) Abort() {
+	w.aborted = true
+	w.closeConn = true
+}
+
+// KeepAlive reports whether the connection can be reused for another request
+// once the response is finished. This requires the headers to have been
+// written with a Content-Length or chunked Transfer-Encoding, so the client
+// can tell where the body ends.
+func (w *Writer) KeepAlive() bool {
+	return w.state > bufferingBody && !w.closeConn
+}
+
+// WriteHeaders writes the header block, sending a 200 status line first if
+// none has been written. If the headers do not frame the body, sending them
+// is deferred until the writer has chosen the framing itself.
+func (w *Writer) WriteHeaders(h *headers.Headers) error {
+	if w.state == writingStatus {
+		if err := w.WriteStatusLine(StatusOK); err != nil {
 			return err
 		}
-		statusLine = statusLine[n:]
 	}
-	return nil
+	if w.state != writingHeaders {
+		return fmt.Errorf("%w: headers already written", ErrWriteOrder)
+	}
+
+	get := w.lookup(h)
+	if len(w.trailerNames) > 0 && get("Content-Length") != "" {
+		return fmt.Errorf("%w: trailers cannot be sent with Content-Length", ErrInvalidTrailer)
+	}
+	if get("Content-Length") == "" && get("Transfer-Encoding") == "" && w.bodyAllowed() {
+		w.deferred = h
+		w.state = bufferingBody
+		return nil
+	}
+	return w.sendHeaders(h, "", "")
+}
+
+// lookup returns a function looking up a header in h, falling back to the
+// headers from Header. Repeated fields are joined into one list.
+func (w *Writer) lookup(h *headers.Headers) func(string) string {
+	return func(name string) string {
+		if v := h.Values(name); len(v) > 0 || w.pending == nil {
+			return strings.Join(v, ", ")
+		}
+		return strings.Join(w.pending.Values(name), ", ")
+	}
 }
 
-func (w *Writer) WriteHeaders(headers *headers.Headers) error {
+// sendHeaders writes h merged with the headers from Header, adding the
+// header name: value if name is not empty.
+func (w *Writer) sendHeaders(h *headers.Headers, name, value string) error {
+	get := w.lookup(h)
+	if hasToken(get("Connection"), "close") || w.awaitingContinue {
+		w.closeConn = true
+	}
+	chunked := name == "Transfer-Encoding" || hasToken(get("Transfer-Encoding"), "chunked")
+	w.unchunked = chunked && w.http10
+	framed := chunked && !w.unchunked || name == "Content-Length" || get("Content-Length") != ""
+	if !framed && w.bodyAllowed() {
+		w.closeConn = true
+	}
+	if chunked {
+		w.state = writingChunkedBody
+	} else {
+		w.state = writingBody
+		w.setContentLength(name, value, get)
+	}
+
 	var p []byte
-	headers.ForEach(func(k, v string) {
-		k = formatHeaderName(k)
-		p = fmt.Appendf(p, "%s: %s\r\n", k, v)
+	h.ForEach(func(k, v string) {
+		if !w.unchunked || !strings.EqualFold(k, "Transfer-Encoding") {
+			p = fmt.Appendf(p, "%s: %s\r\n", k, v)
+		}
 	})
+	if w.pending != nil {
+		w.pending.ForEach(func(k, v string) {
+			if len(h.Values(k)) == 0 && (!w.unchunked || !strings.EqualFold(k, "Transfer-Encoding")) {
+				p = fmt.Appendf(p, "%s: %s\r\n", k, v)
+			}
+		})
+	}
+	if name != "" {
+		p = fmt.Appendf(p, "%s: %s\r\n", name, value)
+	}
+	if len(w.trailerNames) > 0 && chunked && !w.unchunked {
+		p = fmt.Appendf(p, "Trailer: %s\r\n", strings.Join(w.trailerNames, ", "))
+	}
+	if w.closeConn && get("Connection") == "" {
+		p = append(p, []byte("Connection: close\r\n")...)
+	} else if w.http10 && get("Connection") == "" {
+		// HTTP/1.0 connections close by default
+		p = append(p, []byte("Connection: keep-alive\r\n")...)
+	}
 	p = append(p, []byte("\r\n")...)
+	_, err := w.write(p)
+	return err
+}
 
-	for len(p) > 0 {
-		n, err := w.conn.Write(p)
-		if err != nil {
+// setContentLength records the Content-Length being sent, so that the body
+// can be checked against it.
+func (w *Writer) setContentLength(name, value string, get func(string) string) {
+	if name != "Content-Length" {
+		value = get("Content-Length")
+	}
+	if value == "" {
+		return
+	}
+	n, err := strconv.Atoi(value)
+	if err != nil || n < 0 {
+		// The client cannot tell where the body ends
+		w.closeConn = true
+		return
+	}
+	w.contentLength, w.hasLength = n, true
+}
+
+// bodyAllowed reports whether the response status permits a body at all.
+func (w *Writer) bodyAllowed() bool {
+	return w.status >= 200 && w.status != StatusNoContent && w.status != StatusNotModified
+}
+
+func (w *Writer) WriteBody(p []byte) (int, error) {
+	if w.state < bufferingBody {
+		if err := w.WriteHeaders(headers.NewHeaders()); err != nil {
+			return 0, err
+		}
+	}
+	if !w.bodyAllowed() && len(p) > 0 {
+		return 0, fmt.Errorf("%w: %d", ErrBodyNotAllowed, w.status)
+	}
+	switch w.state {
+	case bufferingBody:
+		w.buf = append(w.buf, p...)
+		w.bodyBytes += len(p)
+		if len(w.buf) > bufferSize {
+			if err := w.startChunked(); err != nil {
+				return len(p), err
+			}
+		}
+		return len(p), nil
+	case writingBody:
+	case writingChunkedBody:
+		if w.autoChunked {
+			return w.writeChunk(p)
+		}
+		return 0, fmt.Errorf("%w: use WriteChunkedBody for a chunked response", ErrWriteOrder)
+	default:
+		return 0, fmt.Errorf("%w: body already complete", ErrWriteOrder)
+	}
+
+	var err error
+	if w.hasLength && w.bodyBytes+len(p) > w.contentLength {
+		err = fmt.Errorf("%w: writing %d bytes past %d", ErrBodyLength, w.bodyBytes+len(p)-w.contentLength, w.contentLength)
+		p = p[:w.contentLength-w.bodyBytes]
+	}
+	w.bodyBytes += len(p)
+	if w.omitBody {
+		return len(p), err
+	}
+	n, werr := w.write(p)
+	if werr != nil {
+		return n, werr
+	}
+	return n, err
+}
+
+// Flush sends any buffered body immediately, switching to chunked encoding
+// if the writer has been framing the body itself.
+func (w *Writer) Flush() error {
+	if w.state == bufferingBody {
+		if err := w.startChunked(); err != nil {
 			return err
 		}
-		p = p[n:]
+	}
+	if f, ok := w.conn.(interface{ Flush() error }); ok {
+		return f.Flush()
 	}
 	return nil
 }
 
-func (w *Writer) WriteBody(p []byte) (int, error) {
-	// don't mutate p
-	written := 0
-	for written < len(p) {
-		n, err := w.conn.Write(p[written:])
-		written += n
+// startChunked sends the deferred headers with chunked encoding, followed by
+// the buffered body as the first chunk. For HTTP/1.0 clients the body is
+// sent unframed instead, ending when the connection is closed.
+func (w *Writer) startChunked() error {
+	w.autoChunked = true
+	if w.http10 {
+		if err := w.sendHeaders(w.deferred, "", ""); err != nil {
+			return err
+		}
+		// Chunks are written raw, as for an explicit chunked body
+		w.unchunked = true
+		w.state = writingChunkedBody
+	} else if err := w.sendHeaders(w.deferred, "Transfer-Encoding", "chunked"); err != nil {
+		return err
+	}
+	buf := w.buf
+	w.buf = nil
+	w.bodyBytes -= len(buf)
+	_, err := w.writeChunk(buf)
+	return err
+}
+
+// Finish completes the response once the handler is done: it sends a
+// buffered body with its Content-Length, ends a chunked body along with any
+// trailers, or sends an empty 200 response if nothing was written at all.
+// A body shorter than its declared Content-Length aborts the response with
+// ErrBodyLength, so the connection is not reused.
+func (w *Writer) Finish() error {
+	if w.aborted {
+		return nil
+	}
+	switch w.state {
+	case writingStatus, writingHeaders:
+		if err := w.WriteHeaders(headers.NewHeaders()); err != nil {
+			return err
+		}
+		if w.state != bufferingBody {
+			return nil
+		}
+		fallthrough
+	case bufferingBody:
+		if len(w.trailerNames) > 0 && !w.http10 {
+			// Trailers need chunked encoding
+			if err := w.startChunked(); err != nil {
+				return err
+			}
+			_, err := w.WriteChunkedBodyDone()
+			return err
+		}
+		err := w.sendHeaders(w.deferred, "Content-Length", strconv.Itoa(len(w.buf)))
 		if err != nil {
-			return written, err
+			return err
+		}
+		w.state = responseDone
+		if w.omitBody {
+			return nil
+		}
+		_, err = w.write(w.buf)
+		return err
+	case writingBody:
+		if w.hasLength && w.bodyBytes < w.contentLength && w.bodyAllowed() && !w.omitBody {
+			// The client would read the next response as the rest of this one
+			w.Abort()
+			return fmt.Errorf("%w: wrote %d of %d bytes", ErrBodyLength, w.bodyBytes, w.contentLength)
 		}
+	case writingChunkedBody:
+		_, err := w.WriteChunkedBodyDone()
+		return err
 	}
-	return written, nil
+	return nil
 }
 
+// WriteChunkedBody writes p as a single chunk. If the headers have not been
+// written, they are sent with "Transfer-Encoding: chunked" added.
 func (w *Writer) WriteChunkedBody(p []byte) (int, error) {
+	if w.state < bufferingBody {
+		if err := w.WriteHeaders(headers.NewHeaders()); err != nil {
+			return 0, err
+		}
+	}
+	if w.state == bufferingBody {
+		if err := w.startChunked(); err != nil {
+			return 0, err
+		}
+	}
+	switch w.state {
+	case writingChunkedBody:
+	case writingBody:
+		return 0, fmt.Errorf("%w: response is not chunked", ErrWriteOrder)
+	default:
+		return 0, fmt.Errorf("%w: body already complete", ErrWriteOrder)
+	}
+	return w.writeChunk(p)
+}
+
+func (w *Writer) writeChunk(p []byte) (int, error) {
+	if len(p) == 0 {
+		// A zero length chunk would end the body
+		return 0, nil
+	}
+
+	w.bodyBytes += len(p)
+	if w.omitBody {
+		return len(p), nil
+	}
+	if w.unchunked {
+		return w.write(p)
+	}
 	lenHex := strconv.FormatInt(int64(len(p)), 16)
 	body := fmt.Appendf(nil, "%s\r\n%s\r\n", lenHex, p)
-	written := 0
-	for written < len(body) {
-		n, err := w.conn.Write(body[written:])
-		written += n
-		if err != nil {
-			return written, err
+	return w.write(body)
+}
+
+// WriteChunkedBodyDone ends a chunked body, sending the final chunk followed
+// by the trailer fields set with SetTrailer.
+func (w *Writer) WriteChunkedBodyDone() (int, error) {
+	if w.state != writingChunkedBody {
+		return 0, fmt.Errorf("%w: no chunked body in progress", ErrWriteOrder)
+	}
+	w.state = responseDone
+	if w.omitBody || w.unchunked {
+		return 0, nil
+	}
+
+	p := []byte("0\r\n")
+	if w.trailers != nil {
+		for _, name := range w.trailerNames {
+			if v := w.trailers.Get(name); v != "" {
+				p = fmt.Appendf(p, "%s: %s\r\n", name, v)
+			}
 		}
 	}
-	return written, nil
+	p = append(p, []byte("\r\n")...)
+	return w.write(p)
 }
 
-func (w *Writer) WriteChunkedBodyDone() (int, error) {
-	body := []byte("0\r\n\r\n")
+// DeclareTrailer announces trailer fields in the Trailer header. It must be
+// called before the headers are written, and forces chunked encoding.
+func (w *Writer) DeclareTrailer(names ...string) error {
+	if w.state > writingHeaders {
+		return fmt.Errorf("%w: trailers must be declared before the headers are written", ErrWriteOrder)
+	}
+	for _, name := range names {
+		if !headers.ValidName(name) {
+			return fmt.Errorf("%w: invalid field name %q", ErrInvalidTrailer, name)
+		}
+		if forbiddenTrailers[strings.ToLower(name)] {
+			return fmt.Errorf("%w: %s is not allowed in trailers", ErrInvalidTrailer, name)
+		}
+		if !w.trailerDeclared(name) {
+			w.trailerNames = append(w.trailerNames, name)
+		}
+	}
+	return nil
+}
+
+// SetTrailer sets the value of a declared trailer field, to be sent once the
+// body is complete.
+func (w *Writer) SetTrailer(name, value string) error {
+	if w.state == responseDone {
+		return fmt.Errorf("%w: body already complete", ErrWriteOrder)
+	}
+	if !w.trailerDeclared(name) {
+		return fmt.Errorf("%w: %s was not declared", ErrInvalidTrailer, name)
+	}
+	if w.trailers == nil {
+		w.trailers = headers.NewHeaders()
+	}
+	return w.trailers.OverwriteSet(name, value)
+}
+
+// trailerDeclared reports whether name was declared with DeclareTrailer,
+// ignoring case.
+func (w *Writer) trailerDeclared(name string) bool {
+	return slices.ContainsFunc(w.trailerNames, func(n string) bool {
+		return strings.EqualFold(n, name)
+	})
+}
+
+// WriteTrailers sets the given trailer fields and ends the chunked body,
+// equivalent to calling SetTrailer for each field followed by
+// WriteChunkedBodyDone.
+func (w *Writer) WriteTrailers(t *headers.Headers) error {
+	var err error
+	t.ForEach(func(k, v string) {
+		if err == nil {
+			err = w.SetTrailer(k, v)
+		}
+	})
+	if err != nil {
+		return err
+	}
+	_, err = w.WriteChunkedBodyDone()
+	return err
+}
+
+// write writes all of p to the connection.
+func (w *Writer) write(p []byte) (int, error) {
+	// don't mutate p
 	written := 0
-	for written < len(body) {
-		n, err := w.conn.Write(body[written:])
+	for written < len(p) {
+		n, err := w.conn.Write(p[written:])
 		written += n
 		if err != nil {
 			return written, err
@@ -118,15 +646,13 @@ func (w *Writer) WriteChunkedBodyDone() (int, error) {
 	return written, nil
 }
 
-func (w *Writer) WriteTrailers(t *headers.Headers) error {
-	return w.WriteHeaders(t)
-}
-
-func formatHeaderName(h string) string {
-	c := cases.Title(language.English)
-	parts := strings.Split(h, "-")
-	for i, s := range parts {
-		parts[i] = c.String(s)
+// hasToken reports whether the comma-separated header value v contains token,
+// ignoring case.
+func hasToken(v, token string) bool {
+	for opt := range strings.SplitSeq(v, ",") {
+		if strings.EqualFold(strings.TrimSpace(opt), token) {
+			return true
+		}
 	}
-	return strings.Join(parts, "-")
+	return false
 }
@@ -0,0 +1,471 @@
+package response
+
+import (
+	"bytes"
+	"fmt"
+	"testing"
+
+	"github.com/austin-weeks/http-from-scratch/internal/headers"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestWriterOrder(t *testing.T) {
+	// Test: Status, headers, body
+	var buf bytes.Buffer
+	w := NewWriter(&buf)
+	assert.False(t, w.Committed())
+	require.NoError(t, w.WriteStatusLine(StatusOK))
+	assert.True(t, w.Committed())
+	h := headers.NewHeaders()
+	h.Set("Content-Length", "5")
+	require.NoError(t, w.WriteHeaders(h))
+	_, err := w.WriteBody([]byte("hello"))
+	require.NoError(t, err)
+	assert.Equal(t, "HTTP/1.1 200 OK\r\nContent-Length: 5\r\n\r\nhello", buf.String())
+	assert.True(t, w.KeepAlive())
+
+	// Test: Status line twice
+	require.ErrorIs(t, w.WriteStatusLine(StatusOK), ErrWriteOrder)
+
+	// Test: Headers twice
+	require.ErrorIs(t, w.WriteHeaders(h), ErrWriteOrder)
+
+	// Test: Chunked write on a Content-Length response
+	_, err = w.WriteChunkedBody([]byte("x"))
+	require.ErrorIs(t, err, ErrWriteOrder)
+
+	// Test: Trailers without a chunked body
+	require.ErrorIs(t, w.WriteTrailers(headers.NewHeaders()), ErrWriteOrder)
+}
+
+func TestWriterContentLength(t *testing.T) {
+	h := headers.NewHeaders()
+	h.Set("Content-Length", "5")
+
+	// Test: Body longer than Content-Length cut off
+	var buf bytes.Buffer
+	w := NewWriter(&buf)
+	require.NoError(t, w.WriteHeaders(h))
+	n, err := w.WriteBody([]byte("hel"))
+	require.NoError(t, err)
+	assert.Equal(t, 3, n)
+	n, err = w.WriteBody([]byte("lo world"))
+	require.ErrorIs(t, err, ErrBodyLength)
+	assert.Equal(t, 2, n)
+	_, err = w.WriteBody([]byte("!"))
+	require.ErrorIs(t, err, ErrBodyLength)
+	require.NoError(t, w.Finish())
+	assert.Equal(t, "HTTP/1.1 200 OK\r\nContent-Length: 5\r\n\r\nhello", buf.String())
+	assert.True(t, w.KeepAlive())
+
+	// Test: Body shorter than Content-Length aborts the connection
+	w = NewWriter(&bytes.Buffer{})
+	require.NoError(t, w.WriteHeaders(h))
+	_, err = w.WriteBody([]byte("hel"))
+	require.NoError(t, err)
+	require.ErrorIs(t, w.Finish(), ErrBodyLength)
+	assert.False(t, w.KeepAlive())
+
+	// Test: HEAD response without a body
+	w = NewWriter(&bytes.Buffer{})
+	w.OmitBody()
+	require.NoError(t, w.WriteHeaders(h))
+	require.NoError(t, w.Finish())
+	assert.True(t, w.KeepAlive())
+
+	// Test: Invalid Content-Length closes the connection
+	w = NewWriter(&bytes.Buffer{})
+	bad := headers.NewHeaders()
+	bad.Set("Content-Length", "five")
+	require.NoError(t, w.WriteHeaders(bad))
+	assert.False(t, w.KeepAlive())
+}
+
+func TestWriterImplicitHeaders(t *testing.T) {
+	// Test: Body without status or headers
+	var buf bytes.Buffer
+	w := NewWriter(&buf)
+	w.Header().Set("Content-Type", "text/plain")
+	_, err := w.WriteBody([]byte("hi"))
+	require.NoError(t, err)
+	require.NoError(t, w.Finish())
+	assert.Equal(t, "HTTP/1.1 200 OK\r\nContent-Type: text/plain\r\nContent-Length: 2\r\n\r\nhi", buf.String())
+	assert.Equal(t, StatusOK, w.Status())
+	assert.True(t, w.KeepAlive())
+
+	// Test: Body after status only
+	buf.Reset()
+	w = NewWriter(&buf)
+	require.NoError(t, w.WriteStatusLine(StatusNotFound))
+	_, err = w.WriteBody([]byte("gone"))
+	require.NoError(t, err)
+	require.NoError(t, w.Finish())
+	assert.Equal(t, "HTTP/1.1 404 Not Found\r\nContent-Length: 4\r\n\r\ngone", buf.String())
+
+	// Test: Nothing written
+	buf.Reset()
+	w = NewWriter(&buf)
+	require.NoError(t, w.Finish())
+	assert.Equal(t, "HTTP/1.1 200 OK\r\nContent-Length: 0\r\n\r\n", buf.String())
+
+	// Test: Chunked body without headers
+	buf.Reset()
+	w = NewWriter(&buf)
+	_, err = w.WriteChunkedBody([]byte("abc"))
+	require.NoError(t, err)
+	_, err = w.WriteChunkedBodyDone()
+	require.NoError(t, err)
+	require.NoError(t, w.Finish())
+	assert.Equal(t, "HTTP/1.1 200 OK\r\nTransfer-Encoding: chunked\r\n\r\n3\r\nabc\r\n0\r\n\r\n", buf.String())
+	assert.True(t, w.KeepAlive())
+
+	// Test: Body after the final chunk
+	_, err = w.WriteBody([]byte("x"))
+	require.ErrorIs(t, err, ErrWriteOrder)
+	_, err = w.WriteChunkedBody([]byte("x"))
+	require.ErrorIs(t, err, ErrWriteOrder)
+}
+
+func TestWriterAutoFraming(t *testing.T) {
+	// Test: Large body switches to chunked encoding
+	var buf bytes.Buffer
+	w := NewWriter(&buf)
+	big := bytes.Repeat([]byte("a"), bufferSize+1)
+	_, err := w.WriteBody(big)
+	require.NoError(t, err)
+	_, err = w.WriteBody([]byte("bc"))
+	require.NoError(t, err)
+	require.NoError(t, w.Finish())
+	assert.Equal(t, fmt.Sprintf("HTTP/1.1 200 OK\r\nTransfer-Encoding: chunked\r\n\r\n%x\r\n%s\r\n2\r\nbc\r\n0\r\n\r\n", len(big), big), buf.String())
+	assert.Equal(t, len(big)+2, w.BodyBytes())
+	assert.True(t, w.KeepAlive())
+
+	// Test: Flush switches to chunked encoding
+	buf.Reset()
+	w = NewWriter(&buf)
+	require.NoError(t, w.WriteStatusLine(StatusOK))
+	h := headers.NewHeaders()
+	h.Set("Content-Type", "text/event-stream")
+	require.NoError(t, w.WriteHeaders(h))
+	_, err = w.WriteBody([]byte("one"))
+	require.NoError(t, err)
+	assert.Equal(t, "HTTP/1.1 200 OK\r\n", buf.String())
+	require.NoError(t, w.Flush())
+	_, err = w.WriteBody([]byte("two"))
+	require.NoError(t, err)
+	require.NoError(t, w.Finish())
+	assert.Equal(t, "HTTP/1.1 200 OK\r\nContent-Type: text/event-stream\r\nTransfer-Encoding: chunked\r\n\r\n3\r\none\r\n3\r\ntwo\r\n0\r\n\r\n", buf.String())
+
+	// Test: Explicit Content-Length is written straight through
+	buf.Reset()
+	w = NewWriter(&buf)
+	h = headers.NewHeaders()
+	h.Set("Content-Length", "3")
+	require.NoError(t, w.WriteHeaders(h))
+	_, err = w.WriteBody([]byte("abc"))
+	require.NoError(t, err)
+	assert.Equal(t, "HTTP/1.1 200 OK\r\nContent-Length: 3\r\n\r\nabc", buf.String())
+	require.NoError(t, w.Finish())
+	assert.Equal(t, "HTTP/1.1 200 OK\r\nContent-Length: 3\r\n\r\nabc", buf.String())
+}
+
+func TestWriterNoBody(t *testing.T) {
+	// Test: 204 and 304 never have a body
+	for _, code := range []StatusCode{StatusNoContent, StatusNotModified} {
+		var buf bytes.Buffer
+		w := NewWriter(&buf)
+		require.NoError(t, w.WriteStatusLine(code))
+		_, err := w.WriteBody([]byte("x"))
+		require.ErrorIs(t, err, ErrBodyNotAllowed)
+		require.NoError(t, w.Finish())
+		assert.Equal(t, fmt.Sprintf("HTTP/1.1 %d %s\r\n\r\n", code, StatusText(code)), buf.String())
+		assert.True(t, w.KeepAlive())
+	}
+
+	// Test: HEAD response keeps Content-Length but drops the body
+	var buf bytes.Buffer
+	w := NewWriter(&buf)
+	w.OmitBody()
+	_, err := w.WriteBody([]byte("hello"))
+	require.NoError(t, err)
+	require.NoError(t, w.Finish())
+	assert.Equal(t, "HTTP/1.1 200 OK\r\nContent-Length: 5\r\n\r\n", buf.String())
+
+	// Test: HEAD response with explicit chunked encoding
+	buf.Reset()
+	w = NewWriter(&buf)
+	w.OmitBody()
+	_, err = w.WriteChunkedBody([]byte("hello"))
+	require.NoError(t, err)
+	_, err = w.WriteChunkedBodyDone()
+	require.NoError(t, err)
+	assert.Equal(t, "HTTP/1.1 200 OK\r\nTransfer-Encoding: chunked\r\n\r\n", buf.String())
+}
+
+func TestStatusLine(t *testing.T) {
+	tests := []struct {
+		code StatusCode
+		want string
+	}{
+		{StatusOK, "HTTP/1.1 200 OK\r\n"},
+		{StatusNoContent, "HTTP/1.1 204 No Content\r\n"},
+		{StatusPermanentRedirect, "HTTP/1.1 308 Permanent Redirect\r\n"},
+		{StatusTeapot, "HTTP/1.1 418 I'm a teapot\r\n"},
+		{StatusTooManyRequests, "HTTP/1.1 429 Too Many Requests\r\n"},
+		{StatusServiceUnavailable, "HTTP/1.1 503 Service Unavailable\r\n"},
+		// Unregistered codes are sent with an empty reason phrase
+		{299, "HTTP/1.1 299 \r\n"},
+	}
+	for _, tc := range tests {
+		var buf bytes.Buffer
+		require.NoError(t, NewWriter(&buf).WriteStatusLine(tc.code))
+		assert.Equal(t, tc.want, buf.String())
+	}
+
+	// Test: Codes outside 100-599, and interim codes
+	for _, code := range []StatusCode{0, 99, 600, -200, StatusContinue, StatusEarlyHints} {
+		var buf bytes.Buffer
+		w := NewWriter(&buf)
+		require.ErrorIs(t, w.WriteStatusLine(code), ErrInvalidStatus)
+		assert.Empty(t, buf.String())
+		assert.False(t, w.Committed())
+	}
+}
+
+func TestWriterTrailers(t *testing.T) {
+	// Test: Declared trailers sent with the final chunk
+	var buf bytes.Buffer
+	w := NewWriter(&buf)
+	require.NoError(t, w.DeclareTrailer("X-Checksum", "X-Length"))
+	h := headers.NewHeaders()
+	h.Set("Transfer-Encoding", "chunked")
+	require.NoError(t, w.WriteHeaders(h))
+	_, err := w.WriteChunkedBody([]byte("abc"))
+	require.NoError(t, err)
+	require.NoError(t, w.SetTrailer("X-Checksum", "900150983cd24fb0"))
+	tr := headers.NewHeaders()
+	tr.Set("X-Length", "3")
+	require.NoError(t, w.WriteTrailers(tr))
+	assert.Equal(t, "HTTP/1.1 200 OK\r\n"+
+		"Transfer-Encoding: chunked\r\n"+
+		"Trailer: X-Checksum, X-Length\r\n"+
+		"\r\n"+
+		"3\r\nabc\r\n"+
+		"0\r\n"+
+		"X-Checksum: 900150983cd24fb0\r\n"+
+		"X-Length: 3\r\n"+
+		"\r\n", buf.String())
+	assert.True(t, w.KeepAlive())
+
+	// Test: Trailers force chunked encoding of a buffered body
+	buf.Reset()
+	w = NewWriter(&buf)
+	require.NoError(t, w.DeclareTrailer("X-Checksum"))
+	_, err = w.WriteBody([]byte("abc"))
+	require.NoError(t, err)
+	require.NoError(t, w.SetTrailer("x-checksum", "ok"))
+	require.NoError(t, w.Finish())
+	assert.Equal(t, "HTTP/1.1 200 OK\r\n"+
+		"Transfer-Encoding: chunked\r\n"+
+		"Trailer: X-Checksum\r\n"+
+		"\r\n"+
+		"3\r\nabc\r\n"+
+		"0\r\nX-Checksum: ok\r\n\r\n", buf.String())
+
+	// Test: Forbidden trailer fields
+	w = NewWriter(&bytes.Buffer{})
+	for _, name := range []string{"Content-Length", "Host", "Transfer-Encoding", "Trailer", "Set-Cookie"} {
+		require.ErrorIs(t, w.DeclareTrailer(name), ErrInvalidTrailer, name)
+	}
+
+	// Test: Invalid trailer names
+	for _, name := range []string{"", "X-Sum\r\nSet-Cookie: admin=1", "X Sum", "X-Sum:"} {
+		require.ErrorIs(t, w.DeclareTrailer(name), ErrInvalidTrailer, name)
+	}
+
+	// Test: Undeclared trailer field
+	require.NoError(t, w.DeclareTrailer("X-Declared"))
+	require.ErrorIs(t, w.SetTrailer("X-Other", "v"), ErrInvalidTrailer)
+
+	// Test: Trailers with Content-Length
+	h = headers.NewHeaders()
+	h.Set("Content-Length", "3")
+	require.ErrorIs(t, w.WriteHeaders(h), ErrInvalidTrailer)
+
+	// Test: Declaring after the headers
+	w = NewWriter(&bytes.Buffer{})
+	h = headers.NewHeaders()
+	h.Set("Transfer-Encoding", "chunked")
+	require.NoError(t, w.WriteHeaders(h))
+	require.ErrorIs(t, w.DeclareTrailer("X-Late"), ErrWriteOrder)
+
+	// Test: Setting after the body is complete
+	w = NewWriter(&bytes.Buffer{})
+	require.NoError(t, w.DeclareTrailer("X-Late"))
+	_, err = w.WriteChunkedBody([]byte("abc"))
+	require.NoError(t, err)
+	_, err = w.WriteChunkedBodyDone()
+	require.NoError(t, err)
+	require.ErrorIs(t, w.SetTrailer("X-Late", "v"), ErrWriteOrder)
+
+	// Test: Declared spelling kept
+	buf.Reset()
+	w = NewWriter(&buf)
+	require.NoError(t, w.DeclareTrailer("X-Content-SHA256"))
+	_, err = w.WriteChunkedBody([]byte("abc"))
+	require.NoError(t, err)
+	require.NoError(t, w.SetTrailer("x-content-sha256", "ba7816bf"))
+	_, err = w.WriteChunkedBodyDone()
+	require.NoError(t, err)
+	assert.Contains(t, buf.String(), "Trailer: X-Content-SHA256\r\n")
+	assert.Contains(t, buf.String(), "0\r\nX-Content-SHA256: ba7816bf\r\n\r\n")
+}
+
+func TestWriterRepeatedHeaders(t *testing.T) {
+	var buf bytes.Buffer
+	w := NewWriter(&buf)
+	require.NoError(t, w.WriteStatusLine(StatusOK))
+	h := headers.NewHeaders()
+	h.Set("Content-Length", "0")
+	h.Add("Set-Cookie", "a=1; Expires=Wed, 21 Oct 2015 07:28:00 GMT")
+	h.Add("Set-Cookie", "b=2")
+	require.NoError(t, w.WriteHeaders(h))
+	out := buf.String()
+	assert.Contains(t, out, "Set-Cookie: a=1; Expires=Wed, 21 Oct 2015 07:28:00 GMT\r\nSet-Cookie: b=2\r\n")
+}
+
+func TestWriterHeaderOrder(t *testing.T) {
+	var buf bytes.Buffer
+	w := NewWriter(&buf)
+	w.Header().Set("X-Request-Id", "abc")
+	require.NoError(t, w.WriteStatusLine(StatusOK))
+	h := headers.NewHeaders()
+	h.Set("Content-Type", "text/plain")
+	h.Set("ETag", `"v1"`)
+	h.Set("Content-Length", "0")
+	require.NoError(t, w.WriteHeaders(h))
+	assert.Equal(t, "HTTP/1.1 200 OK\r\nContent-Type: text/plain\r\nETag: \"v1\"\r\nContent-Length: 0\r\nX-Request-Id: abc\r\n\r\n", buf.String())
+}
+
+func TestWriterHTTP10(t *testing.T) {
+	// Test: Buffered body sent with Content-Length and keep-alive
+	var buf bytes.Buffer
+	w := NewWriter(&buf)
+	w.UseHTTP10()
+	_, err := w.WriteBody([]byte("hi"))
+	require.NoError(t, err)
+	require.NoError(t, w.Finish())
+	assert.Equal(t, "HTTP/1.0 200 OK\r\nContent-Length: 2\r\nConnection: keep-alive\r\n\r\nhi", buf.String())
+	assert.True(t, w.KeepAlive())
+
+	// Test: Large body sent unframed instead of chunked
+	buf.Reset()
+	w = NewWriter(&buf)
+	w.UseHTTP10()
+	body := bytes.Repeat([]byte("a"), bufferSize+1)
+	_, err = w.WriteBody(body)
+	require.NoError(t, err)
+	_, err = w.WriteBody([]byte("b"))
+	require.NoError(t, err)
+	require.NoError(t, w.Finish())
+	assert.Equal(t, "HTTP/1.0 200 OK\r\nConnection: close\r\n\r\n"+string(body)+"b", buf.String())
+	assert.False(t, w.KeepAlive())
+
+	// Test: Explicit chunked body and trailers sent raw
+	buf.Reset()
+	w = NewWriter(&buf)
+	w.UseHTTP10()
+	require.NoError(t, w.DeclareTrailer("X-Checksum"))
+	h := headers.NewHeaders()
+	h.Set("Content-Type", "text/plain")
+	h.Set("Transfer-Encoding", "chunked")
+	require.NoError(t, w.WriteHeaders(h))
+	_, err = w.WriteChunkedBody([]byte("hello "))
+	require.NoError(t, err)
+	_, err = w.WriteChunkedBody([]byte("world"))
+	require.NoError(t, err)
+	require.NoError(t, w.SetTrailer("X-Checksum", "abc"))
+	require.NoError(t, w.Finish())
+	assert.Equal(t, "HTTP/1.0 200 OK\r\nContent-Type: text/plain\r\nConnection: close\r\n\r\nhello world", buf.String())
+	assert.False(t, w.KeepAlive())
+
+	// Test: Chunked writes without a Transfer-Encoding header sent raw
+	buf.Reset()
+	w = NewWriter(&buf)
+	w.UseHTTP10()
+	_, err = w.WriteChunkedBody([]byte("hello "))
+	require.NoError(t, err)
+	_, err = w.WriteChunkedBody([]byte("world"))
+	require.NoError(t, err)
+	_, err = w.WriteChunkedBodyDone()
+	require.NoError(t, err)
+	require.NoError(t, w.Finish())
+	assert.Equal(t, "HTTP/1.0 200 OK\r\nConnection: close\r\n\r\nhello world", buf.String())
+	assert.Equal(t, 11, w.BodyBytes())
+	assert.False(t, w.KeepAlive())
+}
+
+func TestWriterContinue(t *testing.T) {
+	// Test: Interim response before the final one
+	var buf bytes.Buffer
+	w := NewWriter(&buf)
+	w.ExpectContinue()
+	require.NoError(t, w.WriteContinue())
+	assert.False(t, w.Committed())
+	_, err := w.WriteBody([]byte("ok"))
+	require.NoError(t, err)
+	require.NoError(t, w.Finish())
+	assert.Equal(t, "HTTP/1.1 100 Continue\r\n\r\nHTTP/1.1 200 OK\r\nContent-Length: 2\r\n\r\nok", buf.String())
+	assert.True(t, w.KeepAlive())
+
+	// Test: Final response without continuing closes the connection
+	buf.Reset()
+	w = NewWriter(&buf)
+	w.ExpectContinue()
+	require.NoError(t, w.WriteStatusLine(StatusUnauthorized))
+	require.NoError(t, w.Finish())
+	assert.Equal(t, "HTTP/1.1 401 Unauthorized\r\nContent-Length: 0\r\nConnection: close\r\n\r\n", buf.String())
+	assert.False(t, w.KeepAlive())
+	assert.ErrorIs(t, w.WriteContinue(), ErrWriteOrder)
+}
+
+func TestWriterInterim(t *testing.T) {
+	// Test: Several interim responses, then one final response
+	var buf bytes.Buffer
+	w := NewWriter(&buf)
+	w.Header().Set("X-Request-Id", "abc")
+	hints := headers.NewHeaders()
+	hints.Add("Link", "</style.css>; rel=preload; as=style")
+	hints.Add("Link", "</app.js>; rel=preload; as=script")
+	require.NoError(t, w.WriteInterim(StatusEarlyHints, hints))
+	require.NoError(t, w.WriteInterim(StatusProcessing, nil))
+	assert.False(t, w.Committed())
+	_, err := w.WriteBody([]byte("ok"))
+	require.NoError(t, err)
+	require.NoError(t, w.Finish())
+	assert.Equal(t, "HTTP/1.1 103 Early Hints\r\n"+
+		"Link: </style.css>; rel=preload; as=style\r\n"+
+		"Link: </app.js>; rel=preload; as=script\r\n\r\n"+
+		"HTTP/1.1 102 Processing\r\n\r\n"+
+		"HTTP/1.1 200 OK\r\nX-Request-Id: abc\r\nContent-Length: 2\r\n\r\nok", buf.String())
+	assert.Equal(t, StatusOK, w.Status())
+
+	// Test: No interim response after the final status
+	assert.ErrorIs(t, w.WriteInterim(StatusEarlyHints, nil), ErrWriteOrder)
+
+	// Test: Only 1xx codes other than 101
+	for _, code := range []StatusCode{StatusOK, StatusSwitchingProtocols, 99} {
+		buf.Reset()
+		w = NewWriter(&buf)
+		assert.ErrorIs(t, w.WriteInterim(code, nil), ErrInvalidStatus)
+		assert.Empty(t, buf.String())
+	}
+
+	// Test: Nothing sent to HTTP/1.0 clients
+	buf.Reset()
+	w = NewWriter(&buf)
+	w.UseHTTP10()
+	require.NoError(t, w.WriteInterim(StatusEarlyHints, hints))
+	assert.Empty(t, buf.String())
+}
@@ -0,0 +1,59 @@
+package server
+
+import (
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/austin-weeks/http-from-scratch/internal/request"
+	"github.com/austin-weeks/http-from-scratch/internal/response"
+)
+
+// continueReader wraps the body of a request sent with
+// "Expect: 100-continue". The client holds the body back until told to send
+// it, so "100 Continue" is sent when the handler first reads the body. A
+// handler that answers without reading, e.g. with 413 or 401, saves the
+// client the upload.
+type continueReader struct {
+	io.ReadCloser
+	w    *response.Writer
+	read bool
+}
+
+func (c *continueReader) Read(p []byte) (int, error) {
+	if !c.read {
+		c.read = true
+		// Once the final status is out it is too late, but clients send
+		// the body anyway after a timeout of their own
+		_ = c.w.WriteContinue()
+	}
+	return c.ReadCloser.Read(p)
+}
+
+// checkExpect handles the Expect header of r, installing a continueReader
+// as the request body if the client is waiting for "100 Continue". It
+// returns an error for expectations the server cannot meet.
+func checkExpect(w *response.Writer, r *request.Request) error {
+	values := r.Headers.Values("Expect")
+	if len(values) == 0 {
+		return nil
+	}
+	for v := range strings.SplitSeq(strings.Join(values, ","), ",") {
+		if !strings.EqualFold(strings.TrimSpace(v), "100-continue") {
+			return fmt.Errorf("unsupported expectation %q", strings.TrimSpace(v))
+		}
+	}
+	// HTTP/1.0 clients do not know about 100 Continue and send the body
+	// straight away
+	if r.RequestLine.HttpVersion == "1.0" {
+		return nil
+	}
+	cl := r.Headers.Get("Content-Length")
+	if r.Headers.Get("Transfer-Encoding") == "" && (cl == "" || cl == "0") {
+		// Nothing is being held back
+		return nil
+	}
+	w.ExpectContinue()
+	r.BodyReader = &continueReader{ReadCloser: r.BodyReader, w: w}
+	return nil
+}
@@ -0,0 +1,70 @@
+package server
+
+import (
+	"bufio"
+	"io"
+	"net"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/austin-weeks/http-from-scratch/internal/request"
+	"github.com/austin-weeks/http-from-scratch/internal/response"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestExpectContinue(t *testing.T) {
+	s := serveTest(t, Config{}, func(w *response.Writer, r *request.Request) {
+		if r.Headers.Get("X-Reject") != "" {
+			writeStatusPage(w, response.StatusContentTooLarge, "too large")
+			return
+		}
+		body, err := io.ReadAll(r.BodyReader)
+		require.NoError(t, err)
+		_, _ = w.WriteBody(body)
+	})
+
+	// Test: 100 Continue sent once the handler reads, body sent after it
+	conn, err := net.Dial("tcp", s.listener.Addr().String())
+	require.NoError(t, err)
+	defer conn.Close() // nolint
+	_ = conn.SetDeadline(time.Now().Add(5 * time.Second))
+	br := bufio.NewReader(conn)
+	_, err = conn.Write([]byte("POST / HTTP/1.1\r\nExpect: 100-continue\r\nContent-Length: 5\r\n\r\n"))
+	require.NoError(t, err)
+	line, err := br.ReadString('\n')
+	require.NoError(t, err)
+	assert.Equal(t, "HTTP/1.1 100 Continue\r\n", line)
+	line, err = br.ReadString('\n')
+	require.NoError(t, err)
+	assert.Equal(t, "\r\n", line)
+	_, err = conn.Write([]byte("hello"))
+	require.NoError(t, err)
+	line, err = br.ReadString('\n')
+	require.NoError(t, err)
+	assert.Equal(t, "HTTP/1.1 200 OK\r\n", line)
+
+	// Test: Connection reused afterwards
+	_, err = conn.Write([]byte("POST / HTTP/1.1\r\nContent-Length: 2\r\nConnection: close\r\n\r\nhi"))
+	require.NoError(t, err)
+	rest, err := io.ReadAll(br)
+	require.NoError(t, err)
+	assert.Contains(t, string(rest), "HTTP/1.1 200 OK\r\n")
+	assert.True(t, strings.HasSuffix(string(rest), "\r\n\r\nhi"))
+
+	// Test: Early rejection skips 100 Continue and closes the connection
+	resp := roundTrip(t, s, "POST / HTTP/1.1\r\nExpect: 100-continue\r\nX-Reject: 1\r\nContent-Length: 5\r\n\r\n")
+	assert.True(t, strings.HasPrefix(resp, "HTTP/1.1 413 Content Too Large\r\n"), resp)
+	assert.Contains(t, resp, "Connection: close\r\n")
+	assert.NotContains(t, resp, "100 Continue")
+
+	// Test: Unknown expectation
+	resp = roundTrip(t, s, "POST / HTTP/1.1\r\nExpect: 100-continue, x-magic\r\nContent-Length: 5\r\n\r\nhello")
+	assert.True(t, strings.HasPrefix(resp, "HTTP/1.1 417 Expectation Failed\r\n"), resp)
+
+	// Test: Ignored for HTTP/1.0
+	resp = roundTrip(t, s, "POST / HTTP/1.0\r\nExpect: 100-continue\r\nContent-Length: 5\r\n\r\nhello")
+	assert.True(t, strings.HasPrefix(resp, "HTTP/1.0 200 OK\r\n"), resp)
+	assert.NotContains(t, resp, "100 Continue")
+}
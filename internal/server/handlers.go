@@ -1,25 +1,37 @@
 package server
 
 import (
+	"fmt"
+
 	"github.com/austin-weeks/http-from-scratch/internal/request"
 	"github.com/austin-weeks/http-from-scratch/internal/response"
 )
 
 type Handler func(w *response.Writer, req *request.Request)
 
-// type HandlerError struct {
-// 	StatusCode response.StatusCode
-// 	Message    string
-// }
-//
-// func (e HandlerError) writeTo(w io.Writer) error {
-// 	p := fmt.Appendf(nil, "Error %d: %s", e.StatusCode, e.Message)
-// 	for len(p) > 0 {
-// 		n, err := w.Write(p)
-// 		if err != nil {
-// 			return err
-// 		}
-// 		p = p[n:]
-// 	}
-// 	return nil
-// }
+// ErrorHandler writes the response for a request that could not be parsed.
+// err describes what was wrong with the request. The connection is closed
+// once it returns.
+type ErrorHandler func(w *response.Writer, code response.StatusCode, err error)
+
+// defaultErrorHandler writes a short plain text description of err.
+func defaultErrorHandler(w *response.Writer, code response.StatusCode, err error) {
+	writeStatusPage(w, code, err.Error())
+}
+
+// writeStatusPage writes a short plain text response for code, with any
+// extra headers given as name, value pairs.
+func writeStatusPage(w *response.Writer, code response.StatusCode, msg string, extra ...string) {
+	body := fmt.Appendf(nil, "Error %d: %s\n", code, msg)
+	h := response.GetDefaultHeaders(len(body))
+	for i := 0; i+1 < len(extra); i += 2 {
+		h.Set(extra[i], extra[i+1])
+	}
+	if err := w.WriteStatusLine(code); err != nil {
+		return
+	}
+	if err := w.WriteHeaders(h); err != nil {
+		return
+	}
+	_, _ = w.WriteBody(body)
+}
@@ -0,0 +1,110 @@
+package server
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"log/slog"
+	"runtime/debug"
+	"time"
+
+	"github.com/austin-weeks/http-from-scratch/internal/request"
+	"github.com/austin-weeks/http-from-scratch/internal/response"
+)
+
+// RequestIDHeader carries the request ID set by the RequestID middleware.
+const RequestIDHeader = "X-Request-Id"
+
+// Middleware wraps a Handler with cross-cutting behavior.
+type Middleware func(next Handler) Handler
+
+// Chain wraps h in the given middleware. The first middleware is the
+// outermost, so it sees the request first and the response last.
+func Chain(h Handler, middleware ...Middleware) Handler {
+	for i := len(middleware) - 1; i >= 0; i-- {
+		h = middleware[i](h)
+	}
+	return h
+}
+
+// Recover catches panics in the wrapped handler and logs them with a stack
+// trace. If the response has not been started, a 500 response is written;
+// otherwise the connection is closed once the handler returns, since the
+// client cannot tell the response is incomplete.
+func Recover(next Handler) Handler {
+	return func(w *response.Writer, r *request.Request) {
+		defer func() {
+			if v := recover(); v != nil {
+				handlePanic(w, r, v, debug.Stack())
+			}
+		}()
+		next(w, r)
+	}
+}
+
+// Logger logs each request once the wrapped handler returns, along with the
+// status code and number of body bytes written.
+func Logger(next Handler) Handler {
+	return func(w *response.Writer, r *request.Request) {
+		start := time.Now()
+		next(w, r)
+		slog.Info("request",
+			"method", r.RequestLine.Method,
+			"target", r.RequestLine.RequestTarget,
+			"status", int(w.Status()),
+			"bytes", w.BodyBytes(),
+			"duration", time.Since(start),
+			"request_id", r.Headers.Get(RequestIDHeader))
+	}
+}
+
+// RequestID ensures every request carries an X-Request-Id header,
+// generating one if the client did not send it, and echoes it in the
+// response.
+func RequestID(next Handler) Handler {
+	return func(w *response.Writer, r *request.Request) {
+		id := r.Headers.Get(RequestIDHeader)
+		if id == "" {
+			id = newRequestID()
+			r.Headers.OverwriteSet(RequestIDHeader, id)
+		}
+		w.Header().OverwriteSet(RequestIDHeader, id)
+		next(w, r)
+	}
+}
+
+// handlePanic logs a panic recovered from a handler and writes a 500
+// response if possible, marking the connection to be closed.
+func handlePanic(w *response.Writer, r *request.Request, v any, stack []byte) {
+	slog.Error("handler panicked",
+		"panic", v,
+		"method", r.RequestLine.Method,
+		"target", r.RequestLine.RequestTarget,
+		"stack", string(stack))
+	if w.Committed() {
+		w.Abort()
+		return
+	}
+	w.CloseAfterResponse()
+	writeStatusPage(w, response.StatusInternalError, "internal server error")
+}
+
+func newRequestID() string {
+	b := make([]byte, 16)
+	_, _ = rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+// Timing reports how long the wrapped handler took, e.g. to record
+// metrics. report is called with the final status code, which is 0 if the
+// handler wrote nothing.
+func Timing(report func(r *request.Request, status response.StatusCode, d time.Duration)) Middleware {
+	return func(next Handler) Handler {
+		return func(w *response.Writer, r *request.Request) {
+			start := time.Now()
+			defer func() {
+				report(r, w.Status(), time.Since(start))
+			}()
+			next(w, r)
+		}
+	}
+}
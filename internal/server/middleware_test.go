@@ -0,0 +1,90 @@
+package server
+
+import (
+	"bytes"
+	"testing"
+	"time"
+
+	"github.com/austin-weeks/http-from-scratch/internal/request"
+	"github.com/austin-weeks/http-from-scratch/internal/response"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// serveOnce runs h for a simple GET request and returns the writer and raw
+// response.
+func serveOnce(t *testing.T, h Handler, extraHeaders string) (*response.Writer, string) {
+	t.Helper()
+	r, err := request.RequestFromReader(bytes.NewReader(
+		[]byte("GET /test HTTP/1.1\r\nHost: localhost\r\n" + extraHeaders + "\r\n")))
+	require.NoError(t, err)
+	var buf bytes.Buffer
+	w := response.NewWriter(&buf)
+	h(w, r)
+	return w, buf.String()
+}
+
+func TestChain(t *testing.T) {
+	var order []string
+	mark := func(name string) Middleware {
+		return func(next Handler) Handler {
+			return func(w *response.Writer, r *request.Request) {
+				order = append(order, name+" before")
+				next(w, r)
+				order = append(order, name+" after")
+			}
+		}
+	}
+	h := Chain(echo("handler"), mark("outer"), mark("inner"))
+	serveOnce(t, h, "")
+	assert.Equal(t, []string{"outer before", "inner before", "inner after", "outer after"}, order)
+}
+
+func TestRecover(t *testing.T) {
+	// Test: Panic before the response is started
+	w, resp := serveOnce(t, Recover(func(w *response.Writer, r *request.Request) {
+		panic("boom")
+	}), "")
+	assert.Contains(t, resp, "HTTP/1.1 500 Internal Server Error\r\n")
+	assert.Equal(t, response.StatusInternalError, w.Status())
+	assert.False(t, w.KeepAlive())
+
+	// Test: Panic after the response is started
+	w, resp = serveOnce(t, Recover(func(w *response.Writer, r *request.Request) {
+		_ = w.WriteStatusLine(response.StatusOK)
+		_ = w.WriteHeaders(response.GetDefaultHeaders(100))
+		panic("boom")
+	}), "")
+	assert.NotContains(t, resp, "500")
+	assert.False(t, w.KeepAlive())
+}
+
+func TestRequestID(t *testing.T) {
+	var seen string
+	h := RequestID(func(w *response.Writer, r *request.Request) {
+		seen = r.Headers.Get(RequestIDHeader)
+		echo("ok")(w, r)
+	})
+
+	// Test: Generated ID
+	_, resp := serveOnce(t, h, "")
+	assert.Len(t, seen, 32)
+	assert.Contains(t, resp, "X-Request-Id: "+seen+"\r\n")
+
+	// Test: Client supplied ID
+	_, resp = serveOnce(t, h, "X-Request-Id: abc123\r\n")
+	assert.Equal(t, "abc123", seen)
+	assert.Contains(t, resp, "X-Request-Id: abc123\r\n")
+}
+
+func TestLoggerAndTiming(t *testing.T) {
+	var status response.StatusCode
+	var d time.Duration
+	h := Chain(echo("hello"), Logger, Timing(func(r *request.Request, s response.StatusCode, dur time.Duration) {
+		status, d = s, dur
+	}))
+	w, _ := serveOnce(t, h, "")
+	assert.Equal(t, response.StatusOK, status)
+	assert.Positive(t, d)
+	assert.Equal(t, len("hello"), w.BodyBytes())
+}
@@ -0,0 +1,198 @@
+package server
+
+import (
+	"errors"
+	"fmt"
+	"net/url"
+	"slices"
+	"strings"
+
+	"github.com/austin-weeks/http-from-scratch/internal/request"
+	"github.com/austin-weeks/http-from-scratch/internal/response"
+)
+
+// Router dispatches requests to handlers registered by method and path
+// pattern. Patterns are made of "/"-separated segments, each either a
+// literal, a wildcard "{name}" matching one non-empty segment, or, as the
+// final segment, "{name...}" matching the remainder of the path. Captured
+// wildcards are available from request.Request.PathValue.
+//
+// Routes registered for GET also serve HEAD requests.
+//
+// Paths are matched one segment at a time before percent-decoding, so an
+// encoded "/" ("%2F") is part of a segment rather than a separator.
+// Captured values are decoded.
+//
+// When several patterns match, the one with the most literal segments wins,
+// preferring patterns without a "{name...}" segment on a tie.
+// Unmatched paths get a 404 response, and paths matched only under other
+// methods get a 405 response listing them in the Allow header.
+type Router struct {
+	routes []route
+}
+
+type route struct {
+	method   string
+	segments []segment
+	handler  Handler
+}
+
+type segment struct {
+	literal  string
+	wildcard string
+	rest     bool
+}
+
+func NewRouter() *Router {
+	return &Router{}
+}
+
+// Handle registers handler for requests with the given method and path
+// pattern. It panics if the pattern is invalid.
+func (rt *Router) Handle(method, pattern string, handler Handler) {
+	if handler == nil {
+		panic("server: nil handler for " + pattern)
+	}
+	segments, err := parsePattern(pattern)
+	if err != nil {
+		panic(fmt.Sprintf("server: invalid pattern %q: %v", pattern, err))
+	}
+	rt.routes = append(rt.routes, route{
+		method:   method,
+		segments: segments,
+		handler:  handler,
+	})
+}
+
+// Serve dispatches r to the best matching route. It has the Handler
+// signature, so a Router can be passed to Serve.
+func (rt *Router) Serve(w *response.Writer, r *request.Request) {
+	path := r.RequestLine.Target.Path
+	rawPath := r.RequestLine.Target.RawPath
+
+	var best *route
+	var bestValues map[string]string
+	var allowed []string
+	for i := range rt.routes {
+		rte := &rt.routes[i]
+		values, ok := rte.match(rawPath)
+		if !ok {
+			continue
+		}
+		if !rte.allows(r.RequestLine.Method) {
+			allowed = append(allowed, rte.method)
+			if rte.method == "GET" {
+				allowed = append(allowed, "HEAD")
+			}
+			continue
+		}
+		if best == nil || rte.specificity() > best.specificity() {
+			best, bestValues = rte, values
+		}
+	}
+
+	switch {
+	case best != nil:
+		for name, v := range bestValues {
+			r.SetPathValue(name, v)
+		}
+		best.handler(w, r)
+	case len(allowed) > 0:
+		slices.Sort(allowed)
+		msg := fmt.Sprintf("method %s not allowed for %s", r.RequestLine.Method, path)
+		writeStatusPage(w, response.StatusMethodNotAllowed, msg,
+			"Allow", strings.Join(slices.Compact(allowed), ", "))
+	default:
+		writeStatusPage(w, response.StatusNotFound, "no route for "+path)
+	}
+}
+
+func parsePattern(pattern string) ([]segment, error) {
+	if !strings.HasPrefix(pattern, "/") {
+		return nil, errors.New("pattern must start with '/'")
+	}
+	parts := strings.Split(pattern[1:], "/")
+	segments := make([]segment, len(parts))
+	for i, p := range parts {
+		name, ok := strings.CutPrefix(p, "{")
+		if !ok {
+			if strings.ContainsAny(p, "{}") {
+				return nil, fmt.Errorf("segment %q mixes literal and wildcard", p)
+			}
+			segments[i] = segment{literal: p}
+			continue
+		}
+		name, ok = strings.CutSuffix(name, "}")
+		if !ok {
+			return nil, fmt.Errorf("unclosed wildcard in segment %q", p)
+		}
+		name, rest := strings.CutSuffix(name, "...")
+		if rest && i != len(parts)-1 {
+			return nil, fmt.Errorf("%q must be the final segment", p)
+		}
+		if name == "" {
+			return nil, fmt.Errorf("wildcard in segment %q has no name", p)
+		}
+		segments[i] = segment{wildcard: name, rest: rest}
+	}
+	return segments, nil
+}
+
+// match reports whether rawPath, still percent-encoded, matches the
+// route's pattern, returning the decoded wildcard values.
+func (rte *route) match(rawPath string) (map[string]string, bool) {
+	if !strings.HasPrefix(rawPath, "/") {
+		return nil, false
+	}
+	path := rawPath[1:]
+	values := make(map[string]string)
+	for i, seg := range rte.segments {
+		if seg.rest {
+			v, err := url.PathUnescape(path)
+			if err != nil {
+				return nil, false
+			}
+			values[seg.wildcard] = v
+			return values, true
+		}
+		raw, remaining, found := strings.Cut(path, "/")
+		if found == (i == len(rte.segments)-1) {
+			// The path has more segments than the pattern, or fewer
+			return nil, false
+		}
+		part, err := url.PathUnescape(raw)
+		if err != nil {
+			return nil, false
+		}
+		if seg.wildcard != "" {
+			if part == "" {
+				return nil, false
+			}
+			values[seg.wildcard] = part
+		} else if part != seg.literal {
+			return nil, false
+		}
+		path = remaining
+	}
+	return values, true
+}
+
+// allows reports whether the route handles method. GET routes also handle
+// HEAD, whose response body the server discards.
+func (rte *route) allows(method string) bool {
+	return rte.method == method || method == "HEAD" && rte.method == "GET"
+}
+
+// specificity ranks routes matching the same path.
+func (rte *route) specificity() int {
+	n := 0
+	for _, seg := range rte.segments {
+		switch {
+		case seg.wildcard == "":
+			n += 2
+		case seg.rest:
+			n--
+		}
+	}
+	return n
+}
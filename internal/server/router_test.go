@@ -0,0 +1,118 @@
+package server
+
+import (
+	"bytes"
+	"fmt"
+	"testing"
+
+	"github.com/austin-weeks/http-from-scratch/internal/request"
+	"github.com/austin-weeks/http-from-scratch/internal/response"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// routeRequest sends a request for method and target through rt and returns the
+// raw response.
+func routeRequest(t *testing.T, rt *Router, method, target string) string {
+	t.Helper()
+	r, err := request.RequestFromReader(bytes.NewReader(
+		fmt.Appendf(nil, "%s %s HTTP/1.1\r\nHost: localhost\r\n\r\n", method, target)))
+	require.NoError(t, err)
+	var buf bytes.Buffer
+	rt.Serve(response.NewWriter(&buf), r)
+	return buf.String()
+}
+
+// echo responds with the route name and the given path values.
+func echo(name string, params ...string) Handler {
+	return func(w *response.Writer, r *request.Request) {
+		body := name
+		for _, p := range params {
+			body += fmt.Sprintf(" %s=%s", p, r.PathValue(p))
+		}
+		_ = w.WriteStatusLine(response.StatusOK)
+		_ = w.WriteHeaders(response.GetDefaultHeaders(len(body)))
+		_, _ = w.WriteBody([]byte(body))
+	}
+}
+
+func TestRouter(t *testing.T) {
+	rt := NewRouter()
+	rt.Handle("GET", "/", echo("root"))
+	rt.Handle("GET", "/users/{id}", echo("user", "id"))
+	rt.Handle("DELETE", "/users/{id}", echo("delete", "id"))
+	rt.Handle("GET", "/users/me", echo("me"))
+	rt.Handle("GET", "/users/{id}/posts/{post}", echo("post", "id", "post"))
+	rt.Handle("GET", "/static/{path...}", echo("static", "path"))
+	rt.Handle("GET", "/files/{dir}/{name}", echo("file", "dir", "name"))
+	rt.Handle("POST", "/upload", echo("upload"))
+
+	tests := []struct {
+		method string
+		target string
+		want   string
+	}{
+		{"GET", "/", "root"},
+		{"GET", "/users/42", "user id=42"},
+		{"GET", "/users/42?x=1", "user id=42"},
+		{"GET", "/users/a%20b", "user id=a b"},
+		{"GET", "/users/a%2Fb", "user id=a/b"},
+		{"GET", "/users/%6De", "me"},
+		{"GET", "/files/a%2Fb/c", "file dir=a/b name=c"},
+		{"GET", "http://localhost/users/42", "user id=42"},
+		{"DELETE", "/users/42", "delete id=42"},
+		{"GET", "/users/me", "me"},
+		{"GET", "/users/7/posts/hello", "post id=7 post=hello"},
+		{"GET", "/static/css/site.css", "static path=css/site.css"},
+		{"GET", "/static/", "static path="},
+		{"GET", "/static/a%2Fb/c%20d", "static path=a/b/c d"},
+		{"POST", "/upload", "upload"},
+	}
+	for _, tc := range tests {
+		t.Run(tc.method+" "+tc.target, func(t *testing.T) {
+			resp := routeRequest(t, rt, tc.method, tc.target)
+			assert.Contains(t, resp, "HTTP/1.1 200 OK\r\n")
+			assert.Contains(t, resp, "\r\n\r\n"+tc.want)
+		})
+	}
+}
+
+func TestRouterErrors(t *testing.T) {
+	rt := NewRouter()
+	rt.Handle("GET", "/users/{id}", echo("user", "id"))
+	rt.Handle("DELETE", "/users/{id}", echo("delete", "id"))
+	rt.Handle("POST", "/upload", echo("upload"))
+	rt.Handle("GET", "/files/{dir}/{name}", echo("file", "dir", "name"))
+
+	// Test: Unknown paths, with an encoded "/" not splitting segments
+	for _, target := range []string{"/", "/users", "/users/", "/users/42/extra", "/uploads", "/files/a%2Fb"} {
+		resp := routeRequest(t, rt, "GET", target)
+		assert.Contains(t, resp, "HTTP/1.1 404 Not Found\r\n", target)
+	}
+
+	// Test: Wrong method
+	resp := routeRequest(t, rt, "PUT", "/users/42")
+	assert.Contains(t, resp, "HTTP/1.1 405 Method Not Allowed\r\n")
+	assert.Contains(t, resp, "Allow: DELETE, GET, HEAD\r\n")
+
+	resp = routeRequest(t, rt, "HEAD", "/users/42")
+	assert.Contains(t, resp, "HTTP/1.1 200 OK\r\n")
+
+	resp = routeRequest(t, rt, "GET", "/upload")
+	assert.Contains(t, resp, "HTTP/1.1 405 Method Not Allowed\r\n")
+	assert.Contains(t, resp, "Allow: POST\r\n")
+}
+
+func TestRouterInvalidPatterns(t *testing.T) {
+	for _, pattern := range []string{
+		"users",
+		"/users/{id",
+		"/users/{}",
+		"/static/{path...}/more",
+		"/users/x{id}",
+	} {
+		assert.Panics(t, func() {
+			NewRouter().Handle("GET", pattern, echo("bad"))
+		}, pattern)
+	}
+}
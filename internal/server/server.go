@@ -2,45 +2,221 @@
 package server
 
 import (
+	"context"
+	"crypto/tls"
 	"errors"
 	"fmt"
+	"io"
 	"log/slog"
 	"net"
+	"runtime/debug"
+	"sync"
 	"sync/atomic"
+	"time"
 
+	"github.com/austin-weeks/http-from-scratch/internal/headers"
 	"github.com/austin-weeks/http-from-scratch/internal/request"
 	"github.com/austin-weeks/http-from-scratch/internal/response"
 )
 
+// maxRequestsPerConn is the number of requests served on a single
+// persistent connection before the server closes it.
+const maxRequestsPerConn = 1000
+
+// maxDiscardBytes is how much of a body left unread by the handler the
+// server will read and throw away to reuse the connection.
+const maxDiscardBytes = 256 << 10
+
+// Config configures a Server. Zero durations mean no timeout.
+type Config struct {
+	// Addr is the TCP address to listen on, e.g. ":42069".
+	Addr string
+	// ErrorHandler responds to requests that could not be parsed. If nil, a
+	// plain text error response is written.
+	ErrorHandler ErrorHandler
+	// ReadHeaderTimeout bounds the time to read a request line and headers,
+	// starting when the connection is accepted or, for later requests on a
+	// keep-alive connection, when their first byte arrives. If zero,
+	// ReadTimeout is used.
+	ReadHeaderTimeout time.Duration
+	// ReadTimeout bounds the time to read an entire request, including its
+	// body.
+	ReadTimeout time.Duration
+	// WriteTimeout bounds the time to write a response, starting once the
+	// request headers have been read.
+	WriteTimeout time.Duration
+	// IdleTimeout bounds the time to wait for the next request on a
+	// keep-alive connection. If zero, ReadTimeout is used.
+	IdleTimeout time.Duration
+	// Limits bounds the size of requests. Requests over a limit are
+	// answered with 414, 431 or 413. Zero fields fall back to
+	// request.DefaultLimits, which leaves bodies unbounded.
+	Limits request.Limits
+	// ObsFold sets how obsolete line folding in request headers is handled.
+	// The zero value rejects it with a 400 response.
+	ObsFold headers.ObsFoldPolicy
+	// PanicHandler, if set, is called with the value and stack trace of any
+	// panic recovered from the handler, e.g. to report it to an error
+	// tracker. The panic is logged and answered with a 500 response, or the
+	// connection closed if the response was already started, regardless.
+	PanicHandler func(r *request.Request, v any, stack []byte)
+	// TLSConfig, if set, serves HTTPS instead of plain HTTP. Its ALPN
+	// protocols are replaced with "http/1.1", the only protocol served. See
+	// CertStore.TLSConfig.
+	TLSConfig *tls.Config
+}
+
+// shutdownPollInterval is how often Shutdown checks for connections that
+// have become idle.
+const shutdownPollInterval = 10 * time.Millisecond
+
+// connState tracks whether a connection is in the middle of a request.
+type connState int
+
+const (
+	stateIdle connState = iota
+	stateActive
+)
+
 type Server struct {
-	listener net.Listener
-	handler  Handler
-	closed   atomic.Bool
+	listener     net.Listener
+	handler      Handler
+	errorHandler atomic.Pointer[ErrorHandler]
+	config       Config
+	closed       atomic.Bool
+
+	mu    sync.Mutex
+	conns map[net.Conn]connState
 }
 
+// Serve listens on the given port with no timeouts and default limits.
 func Serve(port uint16, handler Handler) (*Server, error) {
+	return ServeConfig(Config{Addr: fmt.Sprintf(":%d", port)}, handler)
+}
+
+// ServeTLS listens for HTTPS on the given port using a single certificate
+// and key, which are reloaded when they change on disk.
+func ServeTLS(port uint16, handler Handler, certFile, keyFile string) (*Server, error) {
+	certs, err := NewCertStore(KeyPair{CertFile: certFile, KeyFile: keyFile})
+	if err != nil {
+		return nil, err
+	}
+	return ServeConfig(Config{
+		Addr:      fmt.Sprintf(":%d", port),
+		TLSConfig: certs.TLSConfig(),
+	}, handler)
+}
+
+// ServeConfig listens on config.Addr and serves connections in the
+// background until the server is closed.
+func ServeConfig(config Config, handler Handler) (*Server, error) {
 	if handler == nil {
 		return nil, errors.New("handler function cannot be nil")
 	}
 
-	l, err := net.Listen("tcp", fmt.Sprintf(":%d", port))
+	l, err := net.Listen("tcp", config.Addr)
 	if err != nil {
 		return nil, err
 	}
+	if config.TLSConfig != nil {
+		tc := config.TLSConfig.Clone()
+		// Only HTTP/1.1 is spoken, so never agree to anything else
+		tc.NextProtos = []string{"http/1.1"}
+		l = tls.NewListener(l, tc)
+	}
 	s := &Server{
 		listener: l,
 		handler:  handler,
+		config:   config,
+		conns:    make(map[net.Conn]connState),
 	}
+	s.SetErrorHandler(config.ErrorHandler)
 	go s.listen()
 	return s, nil
 }
 
+// SetErrorHandler replaces the handler used to respond to requests that
+// could not be parsed. Passing nil restores the default plain text response.
+func (s *Server) SetErrorHandler(h ErrorHandler) {
+	if h == nil {
+		s.errorHandler.Store(nil)
+		return
+	}
+	s.errorHandler.Store(&h)
+}
+
+// Close stops accepting connections and closes all open connections
+// immediately, abandoning any in-flight requests.
 func (s *Server) Close() error {
 	s.closed.Store(true)
 	err := s.listener.Close()
+	s.closeConns(false)
 	return err
 }
 
+// Shutdown stops accepting connections, closes idle keep-alive connections
+// and waits for in-flight requests to complete. If ctx expires first, the
+// remaining connections are closed and their number is returned along with
+// the context's error.
+func (s *Server) Shutdown(ctx context.Context) (dropped int, err error) {
+	s.closed.Store(true)
+	err = s.listener.Close()
+	if errors.Is(err, net.ErrClosed) {
+		err = nil
+	}
+
+	ticker := time.NewTicker(shutdownPollInterval)
+	defer ticker.Stop()
+	for {
+		if s.closeConns(true) == 0 {
+			return 0, err
+		}
+		select {
+		case <-ctx.Done():
+			return s.closeConns(false), ctx.Err()
+		case <-ticker.C:
+		}
+	}
+}
+
+// closeConns closes tracked connections, only idle ones if idleOnly is set,
+// and returns how many active connections were closed or, with idleOnly,
+// remain open.
+func (s *Server) closeConns(idleOnly bool) int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	active := 0
+	for c, st := range s.conns {
+		if st == stateActive {
+			active++
+			if idleOnly {
+				continue
+			}
+		}
+		_ = c.Close()
+		delete(s.conns, c)
+	}
+	return active
+}
+
+// setConnState records the state of c. It returns false if the server is
+// shutting down and c must not start a new request.
+func (s *Server) setConnState(c net.Conn, st connState) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.conns[c]; !ok && s.closed.Load() {
+		return false
+	}
+	s.conns[c] = st
+	return true
+}
+
+func (s *Server) forgetConn(c net.Conn) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.conns, c)
+}
+
 func (s *Server) listen() {
 	for {
 		conn, err := s.listener.Accept()
@@ -57,13 +233,223 @@ func (s *Server) listen() {
 
 func (s *Server) handle(conn net.Conn) {
 	defer conn.Close() // nolint
-
-	r, err := request.RequestFromReader(conn)
-	if err != nil {
-		slog.Error("failed to read request", "connection", conn, "error", err)
+	defer s.forgetConn(conn)
+	if !s.setConnState(conn, stateIdle) {
 		return
 	}
 
-	w := response.NewWriter(conn)
+	rr := request.NewReader(conn)
+	rr.ObsFold = s.config.ObsFold
+	rr.Limits = s.limits()
+	for i := 0; i < maxRequestsPerConn; i++ {
+		if i == 0 {
+			_ = conn.SetReadDeadline(deadline(s.readHeaderTimeout()))
+		} else {
+			_ = conn.SetReadDeadline(deadline(s.idleTimeout()))
+		}
+		if err := rr.Wait(); err != nil {
+			return
+		}
+		if !s.setConnState(conn, stateActive) || s.closed.Load() {
+			return
+		}
+		start := time.Now()
+		_ = conn.SetReadDeadline(deadlineFrom(start, s.readHeaderTimeout()))
+
+		r, err := rr.ReadRequestHeaders()
+		if err != nil {
+			if errors.Is(err, io.EOF) {
+				return
+			}
+			slog.Error("failed to read request", "connection", conn, "error", err)
+			if code, ok := errorStatus(err); ok {
+				_ = conn.SetWriteDeadline(deadline(s.config.WriteTimeout))
+				s.writeError(response.NewWriter(conn), code, err)
+				lingerClose(conn)
+			}
+			return
+		}
+		_ = conn.SetReadDeadline(deadlineFrom(start, s.config.ReadTimeout))
+		_ = conn.SetWriteDeadline(deadline(s.config.WriteTimeout))
+
+		w := response.NewWriter(conn)
+		if !r.KeepAlive() || i == maxRequestsPerConn-1 || s.closed.Load() {
+			w.CloseAfterResponse()
+		}
+		if r.RequestLine.HttpVersion == "1.0" {
+			w.UseHTTP10()
+		}
+		if r.RequestLine.Method == "HEAD" {
+			w.OmitBody()
+		}
+		body := &bodyErrorReader{ReadCloser: r.BodyReader}
+		r.BodyReader = body
+		if err := checkExpect(w, r); err != nil {
+			s.writeError(w, response.StatusExpectationFailed, err)
+			lingerClose(conn)
+			return
+		}
+		s.runHandler(w, r)
+		if body.err != nil && !w.Committed() {
+			// The handler gave up on a body that could not be decoded
+			if code, ok := errorStatus(body.err); ok {
+				s.writeError(w, code, body.err)
+				lingerClose(conn)
+				return
+			}
+		}
+		if s.closed.Load() {
+			// Shutdown started while the handler was running
+			w.CloseAfterResponse()
+		}
+		if err := w.Finish(); err != nil {
+			lingerClose(conn)
+			return
+		}
+
+		if !w.KeepAlive() || s.closed.Load() {
+			lingerClose(conn)
+			return
+		}
+		if err := r.DiscardBody(maxDiscardBytes); err != nil {
+			return
+		}
+		if !s.setConnState(conn, stateIdle) {
+			return
+		}
+	}
+}
+
+// runHandler calls the handler, recovering from any panic so that it only
+// affects the connection it happened on.
+func (s *Server) runHandler(w *response.Writer, r *request.Request) {
+	defer func() {
+		v := recover()
+		if v == nil {
+			return
+		}
+		stack := debug.Stack()
+		handlePanic(w, r, v, stack)
+		if s.config.PanicHandler != nil {
+			s.config.PanicHandler(r, v, stack)
+		}
+	}()
 	s.handler(w, r)
 }
+
+// limits returns the configured request limits, with zero fields replaced
+// by their defaults.
+func (s *Server) limits() request.Limits {
+	l := s.config.Limits
+	d := request.DefaultLimits
+	if l.MaxRequestLineBytes == 0 {
+		l.MaxRequestLineBytes = d.MaxRequestLineBytes
+	}
+	if l.MaxHeaderBytes == 0 {
+		l.MaxHeaderBytes = d.MaxHeaderBytes
+	}
+	if l.MaxHeaderCount == 0 {
+		l.MaxHeaderCount = d.MaxHeaderCount
+	}
+	if l.MaxBodyBytes == 0 {
+		l.MaxBodyBytes = d.MaxBodyBytes
+	}
+	return l
+}
+
+// bodyErrorReader records the first error decoding the request body, so a
+// handler that gives up on a malformed or oversized body can be answered
+// like a request whose headers failed to parse.
+type bodyErrorReader struct {
+	io.ReadCloser
+	err error
+}
+
+func (b *bodyErrorReader) Read(p []byte) (int, error) {
+	n, err := b.ReadCloser.Read(p)
+	if err != nil && !errors.Is(err, io.EOF) && b.err == nil {
+		b.err = err
+	}
+	return n, err
+}
+
+func (s *Server) readHeaderTimeout() time.Duration {
+	if s.config.ReadHeaderTimeout != 0 {
+		return s.config.ReadHeaderTimeout
+	}
+	return s.config.ReadTimeout
+}
+
+func (s *Server) idleTimeout() time.Duration {
+	if s.config.IdleTimeout != 0 {
+		return s.config.IdleTimeout
+	}
+	return s.config.ReadTimeout
+}
+
+// deadline returns the connection deadline for a timeout starting now. A
+// zero timeout yields the zero time, which clears the deadline.
+func deadline(timeout time.Duration) time.Time {
+	return deadlineFrom(time.Now(), timeout)
+}
+
+func deadlineFrom(start time.Time, timeout time.Duration) time.Time {
+	if timeout <= 0 {
+		return time.Time{}
+	}
+	return start.Add(timeout)
+}
+
+// writeError responds to a request that failed to parse, closing the
+// connection afterwards.
+func (s *Server) writeError(w *response.Writer, code response.StatusCode, err error) {
+	w.CloseAfterResponse()
+	h := defaultErrorHandler
+	if custom := s.errorHandler.Load(); custom != nil {
+		h = *custom
+	}
+	h(w, code, err)
+	_ = w.Finish()
+}
+
+// lingerTimeout bounds how long lingerClose waits for the client to stop
+// sending.
+const lingerTimeout = 500 * time.Millisecond
+
+// lingerClose shuts down the writing side of conn and drains what the
+// client is still sending. Closing a socket with unread input makes the
+// kernel send a reset, which can destroy a response the client has
+// not read yet.
+func lingerClose(conn net.Conn) {
+	cw, ok := conn.(interface{ CloseWrite() error })
+	if !ok || cw.CloseWrite() != nil {
+		return
+	}
+	_ = conn.SetReadDeadline(time.Now().Add(lingerTimeout))
+	_, _ = io.CopyN(io.Discard, conn, maxDiscardBytes)
+}
+
+// errorStatus maps a request or body parse error to the status code
+// reported to the client. It returns false for I/O errors, where no
+// response can be sent.
+func errorStatus(err error) (response.StatusCode, bool) {
+	switch {
+	case errors.Is(err, request.ErrMalformedRequestLine),
+		errors.Is(err, request.ErrMalformedHeader),
+		errors.Is(err, request.ErrInvalidContentLength),
+		errors.Is(err, request.ErrConflictingFraming),
+		errors.Is(err, request.ErrMalformedChunk):
+		return response.StatusBadRequest, true
+	case errors.Is(err, request.ErrUnsupportedTransferCoding):
+		return response.StatusNotImplemented, true
+	case errors.Is(err, request.ErrUnsupportedVersion):
+		return response.StatusHTTPVersionNotSupported, true
+	case errors.Is(err, request.ErrRequestLineTooLong):
+		return response.StatusURITooLong, true
+	case errors.Is(err, request.ErrHeaderFieldsTooLarge):
+		return response.StatusRequestHeaderFieldsTooLarge, true
+	case errors.Is(err, request.ErrContentTooLarge):
+		return response.StatusContentTooLarge, true
+	}
+	return 0, false
+}
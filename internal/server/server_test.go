@@ -0,0 +1,389 @@
+package server
+
+import (
+	"bufio"
+	"context"
+	"io"
+	"net"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/austin-weeks/http-from-scratch/internal/headers"
+	"github.com/austin-weeks/http-from-scratch/internal/request"
+	"github.com/austin-weeks/http-from-scratch/internal/response"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func serveTest(t *testing.T, config Config, handler Handler) *Server {
+	t.Helper()
+	config.Addr = "127.0.0.1:0"
+	s, err := ServeConfig(config, handler)
+	require.NoError(t, err)
+	t.Cleanup(func() { _ = s.Close() })
+	return s
+}
+
+// roundTrip sends raw on a new connection to s and returns everything the
+// server writes until it closes the connection.
+func roundTrip(t *testing.T, s *Server, raw string) string {
+	t.Helper()
+	conn, err := net.Dial("tcp", s.listener.Addr().String())
+	require.NoError(t, err)
+	defer conn.Close() // nolint
+	_, err = conn.Write([]byte(raw))
+	require.NoError(t, err)
+	resp, err := io.ReadAll(conn)
+	require.NoError(t, err)
+	return string(resp)
+}
+
+func TestHandlerPanic(t *testing.T) {
+	reported := make(chan any, 1)
+	s := serveTest(t, Config{
+		PanicHandler: func(r *request.Request, v any, stack []byte) {
+			assert.NotEmpty(t, stack)
+			reported <- v
+		},
+	}, func(w *response.Writer, r *request.Request) {
+		switch r.RequestLine.RequestTarget {
+		case "/before":
+			panic("before")
+		case "/after":
+			_ = w.WriteStatusLine(response.StatusOK)
+			_ = w.WriteHeaders(response.GetDefaultHeaders(100))
+			panic("after")
+		}
+		echo("ok")(w, r)
+	})
+
+	// Test: Panic before the response is started
+	resp := roundTrip(t, s, "GET /before HTTP/1.1\r\n\r\n")
+	assert.Contains(t, resp, "HTTP/1.1 500 Internal Server Error\r\n")
+	assert.Contains(t, resp, "Connection: close\r\n")
+	assert.Equal(t, "before", <-reported)
+
+	// Test: Panic after the response is started aborts the connection
+	resp = roundTrip(t, s, "GET /after HTTP/1.1\r\n\r\n")
+	assert.Contains(t, resp, "HTTP/1.1 200 OK\r\n")
+	assert.NotContains(t, resp, "500")
+	assert.Equal(t, "after", <-reported)
+
+	// Test: Server keeps serving
+	resp = roundTrip(t, s, "GET / HTTP/1.1\r\nConnection: close\r\n\r\n")
+	assert.Contains(t, resp, "\r\n\r\nok")
+}
+
+func TestHeadRequest(t *testing.T) {
+	s := serveTest(t, Config{}, func(w *response.Writer, r *request.Request) {
+		_, _ = w.WriteBody([]byte("hello"))
+	})
+
+	resp := roundTrip(t, s, "HEAD / HTTP/1.1\r\n\r\nGET / HTTP/1.1\r\nConnection: close\r\n\r\n")
+	assert.Equal(t, "HTTP/1.1 200 OK\r\nContent-Length: 5\r\n\r\n"+
+		"HTTP/1.1 200 OK\r\nContent-Length: 5\r\nConnection: close\r\n\r\nhello", resp)
+}
+
+func TestContentLengthMismatch(t *testing.T) {
+	s := serveTest(t, Config{}, func(w *response.Writer, r *request.Request) {
+		h := headers.NewHeaders()
+		h.Set("Content-Length", "5")
+		_ = w.WriteHeaders(h)
+		_, _ = w.WriteBody([]byte(strings.TrimPrefix(r.RequestLine.RequestTarget, "/")))
+	})
+	next := "GET /again HTTP/1.1\r\nConnection: close\r\n\r\n"
+
+	// Test: Extra bytes dropped, connection stays in sync
+	resp := roundTrip(t, s, "GET /hello-world HTTP/1.1\r\n\r\n"+next)
+	assert.Equal(t, "HTTP/1.1 200 OK\r\nContent-Length: 5\r\n\r\nhello"+
+		"HTTP/1.1 200 OK\r\nContent-Length: 5\r\nConnection: close\r\n\r\nagain", resp)
+
+	// Test: Short body closes the connection
+	resp = roundTrip(t, s, "GET /hi HTTP/1.1\r\n\r\n"+next)
+	assert.Equal(t, "HTTP/1.1 200 OK\r\nContent-Length: 5\r\n\r\nhi", resp)
+}
+
+func TestLimits(t *testing.T) {
+	s := serveTest(t, Config{Limits: request.Limits{
+		MaxRequestLineBytes: 64,
+		MaxHeaderCount:      2,
+		MaxBodyBytes:        10,
+	}}, func(w *response.Writer, r *request.Request) {
+		body, err := io.ReadAll(r.BodyReader)
+		if err != nil {
+			return
+		}
+		_, _ = w.WriteBody(body)
+	})
+
+	// Test: Content-Length over the body limit
+	resp := roundTrip(t, s, "POST / HTTP/1.1\r\nContent-Length: 11\r\n\r\nhello world")
+	assert.True(t, strings.HasPrefix(resp, "HTTP/1.1 413 Content Too Large\r\n"), resp)
+
+	// Test: Chunked body growing past the limit
+	resp = roundTrip(t, s, "POST / HTTP/1.1\r\nTransfer-Encoding: chunked\r\n\r\n"+
+		"5\r\nhello\r\n6\r\n world\r\n0\r\n\r\n")
+	assert.True(t, strings.HasPrefix(resp, "HTTP/1.1 413 Content Too Large\r\n"), resp)
+	assert.Contains(t, resp, "Connection: close\r\n")
+
+	// Test: Malformed chunked body
+	resp = roundTrip(t, s, "POST / HTTP/1.1\r\nTransfer-Encoding: chunked\r\n\r\nzz\r\n")
+	assert.True(t, strings.HasPrefix(resp, "HTTP/1.1 400 Bad Request\r\n"), resp)
+
+	// Test: Body within the limit
+	resp = roundTrip(t, s, "POST / HTTP/1.1\r\nContent-Length: 5\r\nConnection: close\r\n\r\nhello")
+	assert.True(t, strings.HasSuffix(resp, "\r\n\r\nhello"), resp)
+
+	// Test: Request line too long
+	resp = roundTrip(t, s, "GET /"+strings.Repeat("a", 64)+" HTTP/1.1\r\n\r\n")
+	assert.True(t, strings.HasPrefix(resp, "HTTP/1.1 414 URI Too Long\r\n"), resp)
+
+	// Test: Too many header fields
+	resp = roundTrip(t, s, "GET / HTTP/1.1\r\nA: 1\r\nB: 2\r\nC: 3\r\n\r\n")
+	assert.True(t, strings.HasPrefix(resp, "HTTP/1.1 431 Request Header Fields Too Large\r\n"), resp)
+}
+
+func TestObsFold(t *testing.T) {
+	handler := func(w *response.Writer, r *request.Request) {
+		_, _ = w.WriteBody([]byte(r.Headers.Get("X-Long")))
+	}
+	raw := "GET / HTTP/1.1\r\nX-Long: a\r\n b\r\nConnection: close\r\n\r\n"
+
+	// Test: Rejected by default
+	s := serveTest(t, Config{}, handler)
+	assert.Contains(t, roundTrip(t, s, raw), "HTTP/1.1 400 Bad Request\r\n")
+
+	// Test: Replaced when configured
+	s = serveTest(t, Config{ObsFold: headers.ReplaceObsFold}, handler)
+	assert.Contains(t, roundTrip(t, s, raw), "HTTP/1.1 200 OK\r\n")
+	assert.Contains(t, roundTrip(t, s, raw), "\r\n\r\na b")
+}
+
+func TestSmugglingRejected(t *testing.T) {
+	s := serveTest(t, Config{}, func(w *response.Writer, r *request.Request) {
+		switch r.Headers.Get("X-Body") {
+		case "wrap":
+			r.BodyReader = io.NopCloser(io.LimitReader(r.BodyReader, 4))
+		case "nil":
+			r.BodyReader = nil
+		}
+		_, _ = w.WriteBody([]byte("handled " + r.RequestLine.RequestTarget))
+	})
+
+	// Test: CL.TE answered once with 400, smuggled request never served
+	resp := roundTrip(t, s, "POST / HTTP/1.1\r\nContent-Length: 35\r\nTransfer-Encoding: chunked\r\n\r\n"+
+		"0\r\n\r\nGET /admin HTTP/1.1\r\nX: \r\n\r\n")
+	assert.True(t, strings.HasPrefix(resp, "HTTP/1.1 400 Bad Request\r\n"), resp)
+	assert.Equal(t, 1, strings.Count(resp, "HTTP/1.1"))
+	assert.NotContains(t, resp, "handled")
+
+	// Test: Unknown transfer coding
+	resp = roundTrip(t, s, "POST / HTTP/1.1\r\nTransfer-Encoding: gzip, chunked\r\n\r\n0\r\n\r\n")
+	assert.True(t, strings.HasPrefix(resp, "HTTP/1.1 501 Not Implemented\r\n"), resp)
+
+	// Test: Body left unread behind a wrapped body reader is still discarded
+	smuggled := "GET /smuggled HTTP/1.1\r\n\r\n"
+	resp = roundTrip(t, s, "POST / HTTP/1.1\r\nX-Body: wrap\r\nContent-Length: 26\r\n\r\n"+smuggled+
+		"GET /next HTTP/1.1\r\nConnection: close\r\n\r\n")
+	assert.Contains(t, resp, "handled /next")
+	assert.NotContains(t, resp, "handled /smuggled")
+
+	// Test: Body reader set to nil
+	resp = roundTrip(t, s, "POST / HTTP/1.1\r\nX-Body: nil\r\nContent-Length: 26\r\n\r\n"+smuggled+
+		"GET /next HTTP/1.1\r\nConnection: close\r\n\r\n")
+	assert.Contains(t, resp, "handled /next")
+	assert.NotContains(t, resp, "handled /smuggled")
+}
+
+func TestHTTP10(t *testing.T) {
+	s := serveTest(t, Config{}, func(w *response.Writer, r *request.Request) {
+		_, _ = w.WriteBody([]byte("hello"))
+	})
+
+	// Test: Closed after one response by default
+	resp := roundTrip(t, s, "GET / HTTP/1.0\r\n\r\nGET / HTTP/1.0\r\n\r\n")
+	assert.Equal(t, "HTTP/1.0 200 OK\r\nContent-Length: 5\r\nConnection: close\r\n\r\nhello", resp)
+
+	// Test: Kept alive on request
+	resp = roundTrip(t, s, "GET / HTTP/1.0\r\nConnection: keep-alive\r\n\r\nGET / HTTP/1.0\r\n\r\n")
+	assert.Equal(t, "HTTP/1.0 200 OK\r\nContent-Length: 5\r\nConnection: keep-alive\r\n\r\nhello"+
+		"HTTP/1.0 200 OK\r\nContent-Length: 5\r\nConnection: close\r\n\r\nhello", resp)
+}
+
+// dial opens a connection to s that fails reads and writes after a few
+// seconds rather than hanging the test.
+func dial(t *testing.T, s *Server) net.Conn {
+	t.Helper()
+	conn, err := net.Dial("tcp", s.listener.Addr().String())
+	require.NoError(t, err)
+	t.Cleanup(func() { _ = conn.Close() })
+	_ = conn.SetDeadline(time.Now().Add(5 * time.Second))
+	return conn
+}
+
+func TestShutdown(t *testing.T) {
+	started := make(chan struct{}, 1)
+	release := make(chan struct{})
+	s := serveTest(t, Config{}, func(w *response.Writer, r *request.Request) {
+		if r.RequestLine.Target.Path == "/slow" {
+			started <- struct{}{}
+			<-release
+		}
+		_, _ = w.WriteBody([]byte("done"))
+	})
+
+	// Idle keep-alive connection
+	idle := dial(t, s)
+	_, err := idle.Write([]byte("GET / HTTP/1.1\r\n\r\n"))
+	require.NoError(t, err)
+	br := bufio.NewReader(idle)
+	line, err := br.ReadString('\n')
+	require.NoError(t, err)
+	assert.Equal(t, "HTTP/1.1 200 OK\r\n", line)
+
+	// In-flight request
+	busy := dial(t, s)
+	_, err = busy.Write([]byte("GET /slow HTTP/1.1\r\n\r\n"))
+	require.NoError(t, err)
+	<-started
+
+	type result struct {
+		dropped int
+		err     error
+	}
+	done := make(chan result, 1)
+	go func() {
+		dropped, err := s.Shutdown(context.Background())
+		done <- result{dropped, err}
+	}()
+
+	// Test: Idle connection closed straight away
+	rest, err := io.ReadAll(br)
+	require.NoError(t, err)
+	assert.Equal(t, "Content-Length: 4\r\n\r\ndone", string(rest))
+
+	// Test: New connections refused
+	require.Eventually(t, func() bool {
+		c, err := net.Dial("tcp", s.listener.Addr().String())
+		if err == nil {
+			_ = c.Close()
+		}
+		return err != nil
+	}, time.Second, 10*time.Millisecond)
+
+	// Test: Shutdown waits for the in-flight request
+	select {
+	case <-done:
+		t.Fatal("Shutdown returned before the handler finished")
+	case <-time.After(50 * time.Millisecond):
+	}
+	close(release)
+	resp, err := io.ReadAll(busy)
+	require.NoError(t, err)
+	assert.Equal(t, "HTTP/1.1 200 OK\r\nContent-Length: 4\r\nConnection: close\r\n\r\ndone", string(resp))
+	res := <-done
+	require.NoError(t, res.err)
+	assert.Equal(t, 0, res.dropped)
+}
+
+func TestShutdownTimeout(t *testing.T) {
+	started := make(chan struct{}, 2)
+	release := make(chan struct{})
+	t.Cleanup(func() { close(release) })
+	s := serveTest(t, Config{}, func(w *response.Writer, r *request.Request) {
+		started <- struct{}{}
+		<-release
+	})
+
+	conns := []net.Conn{dial(t, s), dial(t, s)}
+	for _, c := range conns {
+		_, err := c.Write([]byte("GET / HTTP/1.1\r\n\r\n"))
+		require.NoError(t, err)
+		<-started
+	}
+
+	// Test: Remaining connections closed and counted once ctx expires
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	dropped, err := s.Shutdown(ctx)
+	require.ErrorIs(t, err, context.DeadlineExceeded)
+	assert.Equal(t, 2, dropped)
+	for _, c := range conns {
+		resp, _ := io.ReadAll(c)
+		assert.Empty(t, resp)
+	}
+}
+
+func TestTimeouts(t *testing.T) {
+	handler := func(w *response.Writer, r *request.Request) {
+		_, _ = w.WriteBody([]byte("ok"))
+	}
+
+	// Test: Slowloris client trickling headers is cut off
+	s := serveTest(t, Config{ReadHeaderTimeout: 100 * time.Millisecond}, handler)
+	conn := dial(t, s)
+	start := time.Now()
+	_, err := conn.Write([]byte("GET / HTTP/1.1\r\n"))
+	require.NoError(t, err)
+	for range 20 {
+		if _, err := conn.Write([]byte("X-A: 1\r\n")); err != nil {
+			break
+		}
+		time.Sleep(25 * time.Millisecond)
+	}
+	resp, _ := io.ReadAll(conn)
+	assert.Empty(t, resp)
+	assert.Less(t, time.Since(start), time.Second)
+
+	// Test: Idle keep-alive connection closed after IdleTimeout
+	s = serveTest(t, Config{ReadHeaderTimeout: time.Second, IdleTimeout: 100 * time.Millisecond}, handler)
+	conn = dial(t, s)
+	_, err = conn.Write([]byte("GET / HTTP/1.1\r\n\r\n"))
+	require.NoError(t, err)
+	start = time.Now()
+	resp, err = io.ReadAll(conn)
+	require.NoError(t, err)
+	assert.Equal(t, "HTTP/1.1 200 OK\r\nContent-Length: 2\r\n\r\nok", string(resp))
+	assert.Less(t, time.Since(start), time.Second)
+
+	// Test: Header deadline for later requests starts at their first byte
+	s = serveTest(t, Config{ReadHeaderTimeout: 100 * time.Millisecond, IdleTimeout: time.Second}, handler)
+	conn = dial(t, s)
+	br := bufio.NewReader(conn)
+	for i, raw := range []string{"GET / HTTP/1.1\r\n\r\n", "GET / HTTP/1.1\r\nConnection: close\r\n\r\n"} {
+		if i > 0 {
+			// Idle for longer than ReadHeaderTimeout
+			time.Sleep(200 * time.Millisecond)
+		}
+		_, err = conn.Write([]byte(raw))
+		require.NoError(t, err)
+		line, err := br.ReadString('\n')
+		require.NoError(t, err)
+		assert.Equal(t, "HTTP/1.1 200 OK\r\n", line)
+		for line != "\r\n" {
+			line, err = br.ReadString('\n')
+			require.NoError(t, err)
+		}
+		_, err = br.Discard(len("ok"))
+		require.NoError(t, err)
+	}
+
+	// Test: Body trickled past ReadTimeout fails the handler's read
+	bodyErr := make(chan error, 1)
+	s = serveTest(t, Config{ReadTimeout: 100 * time.Millisecond}, func(w *response.Writer, r *request.Request) {
+		_, err := io.ReadAll(r.BodyReader)
+		bodyErr <- err
+	})
+	conn = dial(t, s)
+	_, err = conn.Write([]byte("POST / HTTP/1.1\r\nContent-Length: 10\r\n\r\nab"))
+	require.NoError(t, err)
+	select {
+	case err := <-bodyErr:
+		var ne net.Error
+		require.ErrorAs(t, err, &ne)
+		assert.True(t, ne.Timeout())
+	case <-time.After(time.Second):
+		t.Fatal("body read not timed out")
+	}
+}
@@ -0,0 +1,123 @@
+package server
+
+import (
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"os"
+	"sync"
+	"time"
+)
+
+// certCheckInterval is how often a CertStore checks its files for changes
+// during handshakes.
+var certCheckInterval = time.Second
+
+// KeyPair names a PEM encoded certificate chain and private key on disk.
+type KeyPair struct {
+	CertFile string
+	KeyFile  string
+}
+
+// CertStore serves certificates loaded from disk, choosing one per
+// connection based on the client's SNI server name. Files are reloaded when
+// they change, so renewed certificates are picked up without a restart.
+type CertStore struct {
+	pairs []KeyPair
+
+	mu        sync.RWMutex
+	certs     []*tls.Certificate
+	modTimes  []time.Time
+	lastCheck time.Time
+}
+
+// NewCertStore loads the given key pairs. The first pair is used for
+// clients that do not send a matching server name.
+func NewCertStore(pairs ...KeyPair) (*CertStore, error) {
+	if len(pairs) == 0 {
+		return nil, errors.New("at least one key pair is required")
+	}
+	c := &CertStore{
+		pairs:    pairs,
+		certs:    make([]*tls.Certificate, len(pairs)),
+		modTimes: make([]time.Time, len(pairs)),
+	}
+	if err := c.Reload(); err != nil {
+		return nil, err
+	}
+	return c, nil
+}
+
+// Reload loads every key pair whose files have changed since they were last
+// loaded. If any pair fails to load, the previously loaded certificates are
+// kept.
+func (c *CertStore) Reload() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.lastCheck = time.Now()
+
+	certs := make([]*tls.Certificate, len(c.pairs))
+	modTimes := make([]time.Time, len(c.pairs))
+	for i, p := range c.pairs {
+		modTime, err := latestModTime(p.CertFile, p.KeyFile)
+		if err != nil {
+			return err
+		}
+		if c.certs[i] != nil && modTime.Equal(c.modTimes[i]) {
+			certs[i], modTimes[i] = c.certs[i], c.modTimes[i]
+			continue
+		}
+		cert, err := tls.LoadX509KeyPair(p.CertFile, p.KeyFile)
+		if err != nil {
+			return fmt.Errorf("loading %s: %w", p.CertFile, err)
+		}
+		certs[i], modTimes[i] = &cert, modTime
+	}
+	c.certs, c.modTimes = certs, modTimes
+	return nil
+}
+
+// GetCertificate implements tls.Config.GetCertificate.
+func (c *CertStore) GetCertificate(hello *tls.ClientHelloInfo) (*tls.Certificate, error) {
+	c.mu.RLock()
+	stale := time.Since(c.lastCheck) >= certCheckInterval
+	c.mu.RUnlock()
+	if stale {
+		// Keep serving the old certificates if the new files are broken,
+		// e.g. only half written
+		_ = c.Reload()
+	}
+
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	for _, cert := range c.certs {
+		if hello.SupportsCertificate(cert) == nil {
+			return cert, nil
+		}
+	}
+	return c.certs[0], nil
+}
+
+// TLSConfig returns a server TLS configuration using the store's
+// certificates and advertising HTTP/1.1 via ALPN.
+func (c *CertStore) TLSConfig() *tls.Config {
+	return &tls.Config{
+		GetCertificate: c.GetCertificate,
+		NextProtos:     []string{"http/1.1"},
+		MinVersion:     tls.VersionTLS12,
+	}
+}
+
+func latestModTime(files ...string) (time.Time, error) {
+	var latest time.Time
+	for _, f := range files {
+		info, err := os.Stat(f)
+		if err != nil {
+			return time.Time{}, err
+		}
+		if info.ModTime().After(latest) {
+			latest = info.ModTime()
+		}
+	}
+	return latest, nil
+}
@@ -0,0 +1,179 @@
+package server
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"io"
+	"math/big"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/austin-weeks/http-from-scratch/internal/request"
+	"github.com/austin-weeks/http-from-scratch/internal/response"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// writeSelfSigned writes a self-signed certificate for host and its key to
+// dir with the given serial number.
+func writeSelfSigned(t *testing.T, dir, host string, serial int64) KeyPair {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	tmpl := &x509.Certificate{
+		SerialNumber: big.NewInt(serial),
+		Subject:      pkix.Name{CommonName: host},
+		DNSNames:     []string{host},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &key.PublicKey, key)
+	require.NoError(t, err)
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	require.NoError(t, err)
+
+	pair := KeyPair{
+		CertFile: filepath.Join(dir, host+".crt"),
+		KeyFile:  filepath.Join(dir, host+".key"),
+	}
+	certPEM := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})
+	keyPEM := pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER})
+	require.NoError(t, os.WriteFile(pair.CertFile, certPEM, 0o600))
+	require.NoError(t, os.WriteFile(pair.KeyFile, keyPEM, 0o600))
+	return pair
+}
+
+// handshake connects to s with the given SNI name and returns the serial
+// number of the certificate presented and the negotiated ALPN protocol.
+func handshake(t *testing.T, s *Server, serverName string) (int64, string) {
+	t.Helper()
+	conn, err := tls.Dial("tcp", s.listener.Addr().String(), &tls.Config{
+		ServerName:         serverName,
+		InsecureSkipVerify: true, // nolint
+		NextProtos:         []string{"http/1.1"},
+	})
+	require.NoError(t, err)
+	defer conn.Close() // nolint
+	st := conn.ConnectionState()
+	return st.PeerCertificates[0].SerialNumber.Int64(), st.NegotiatedProtocol
+}
+
+func serveTestTLS(t *testing.T, certs *CertStore) *Server {
+	t.Helper()
+	s, err := ServeConfig(Config{
+		Addr:      "127.0.0.1:0",
+		TLSConfig: certs.TLSConfig(),
+	}, func(w *response.Writer, r *request.Request) {
+		body := []byte("hello over TLS")
+		_ = w.WriteStatusLine(response.StatusOK)
+		_ = w.WriteHeaders(response.GetDefaultHeaders(len(body)))
+		_, _ = w.WriteBody(body)
+	})
+	require.NoError(t, err)
+	t.Cleanup(func() { _ = s.Close() })
+	return s
+}
+
+func TestTLSServe(t *testing.T) {
+	dir := t.TempDir()
+	certs, err := NewCertStore(writeSelfSigned(t, dir, "localhost", 1))
+	require.NoError(t, err)
+	s := serveTestTLS(t, certs)
+
+	conn, err := tls.Dial("tcp", s.listener.Addr().String(), &tls.Config{
+		ServerName:         "localhost",
+		InsecureSkipVerify: true, // nolint
+	})
+	require.NoError(t, err)
+	defer conn.Close() // nolint
+	_, err = conn.Write([]byte("GET / HTTP/1.1\r\nHost: localhost\r\nConnection: close\r\n\r\n"))
+	require.NoError(t, err)
+	resp, err := io.ReadAll(conn)
+	require.NoError(t, err)
+	assert.Contains(t, string(resp), "HTTP/1.1 200 OK\r\n")
+	assert.Contains(t, string(resp), "\r\n\r\nhello over TLS")
+
+	// Test: ALPN
+	_, proto := handshake(t, s, "localhost")
+	assert.Equal(t, "http/1.1", proto)
+}
+
+func TestTLSALPN(t *testing.T) {
+	dir := t.TempDir()
+	certs, err := NewCertStore(writeSelfSigned(t, dir, "localhost", 1))
+	require.NoError(t, err)
+	tc := certs.TLSConfig()
+	tc.NextProtos = []string{"h2"}
+	s, err := ServeConfig(Config{Addr: "127.0.0.1:0", TLSConfig: tc}, echo("ok"))
+	require.NoError(t, err)
+	t.Cleanup(func() { _ = s.Close() })
+
+	// Test: HTTP/2 never negotiated, even if configured
+	conn, err := tls.Dial("tcp", s.listener.Addr().String(), &tls.Config{
+		ServerName:         "localhost",
+		InsecureSkipVerify: true, // nolint
+		NextProtos:         []string{"h2", "http/1.1"},
+	})
+	require.NoError(t, err)
+	defer conn.Close() // nolint
+	assert.Equal(t, "http/1.1", conn.ConnectionState().NegotiatedProtocol)
+	assert.Equal(t, []string{"h2"}, tc.NextProtos)
+}
+
+func TestTLSSNI(t *testing.T) {
+	dir := t.TempDir()
+	certs, err := NewCertStore(
+		writeSelfSigned(t, dir, "a.test", 1),
+		writeSelfSigned(t, dir, "b.test", 2),
+	)
+	require.NoError(t, err)
+	s := serveTestTLS(t, certs)
+
+	serial, _ := handshake(t, s, "a.test")
+	assert.Equal(t, int64(1), serial)
+	serial, _ = handshake(t, s, "b.test")
+	assert.Equal(t, int64(2), serial)
+
+	// Test: Unknown name falls back to the first certificate
+	serial, _ = handshake(t, s, "c.test")
+	assert.Equal(t, int64(1), serial)
+}
+
+func TestTLSReload(t *testing.T) {
+	interval := certCheckInterval
+	certCheckInterval = 0
+	t.Cleanup(func() { certCheckInterval = interval })
+
+	dir := t.TempDir()
+	pair := writeSelfSigned(t, dir, "localhost", 1)
+	certs, err := NewCertStore(pair)
+	require.NoError(t, err)
+	s := serveTestTLS(t, certs)
+
+	serial, _ := handshake(t, s, "localhost")
+	assert.Equal(t, int64(1), serial)
+
+	// Test: Renewed certificate picked up on the next handshake
+	writeSelfSigned(t, dir, "localhost", 2)
+	later := time.Now().Add(time.Minute)
+	require.NoError(t, os.Chtimes(pair.CertFile, later, later))
+	serial, _ = handshake(t, s, "localhost")
+	assert.Equal(t, int64(2), serial)
+
+	// Test: Broken files keep the previous certificate
+	require.NoError(t, os.WriteFile(pair.CertFile, []byte("not a certificate"), 0o600))
+	later = later.Add(time.Minute)
+	require.NoError(t, os.Chtimes(pair.CertFile, later, later))
+	assert.Error(t, certs.Reload())
+	serial, _ = handshake(t, s, "localhost")
+	assert.Equal(t, int64(2), serial)
+}
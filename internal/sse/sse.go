@@ -0,0 +1,198 @@
+// Package sse streams Server-Sent Events (text/event-stream) over a
+// response.Writer.
+package sse
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/austin-weeks/http-from-scratch/internal/headers"
+	"github.com/austin-weeks/http-from-scratch/internal/request"
+	"github.com/austin-weeks/http-from-scratch/internal/response"
+)
+
+// DefaultHeartbeat is a heartbeat interval short enough to keep idle
+// streams open through most proxies.
+const DefaultHeartbeat = 15 * time.Second
+
+var (
+	// ErrInvalidEvent is returned by Send for an event or id field
+	// containing a line break or NUL, which would corrupt the stream.
+	ErrInvalidEvent = errors.New("invalid event field")
+	// ErrClosed is returned for writes after the stream was closed.
+	ErrClosed = errors.New("event stream closed")
+)
+
+// Event is a single event. Empty fields are left out.
+type Event struct {
+	// Event names the event type, "message" if empty.
+	Event string
+	// ID sets the client's last event ID, sent back in the Last-Event-ID
+	// header when it reconnects.
+	ID string
+	// Data is the payload. It may span several lines.
+	Data string
+	// Retry tells the client how long to wait before reconnecting.
+	Retry time.Duration
+}
+
+// Stream writes events to a client. Its methods may be called from
+// several goroutines.
+type Stream struct {
+	mu     sync.Mutex
+	w      *response.Writer
+	err    error
+	done   chan struct{}
+	ticker *time.Ticker
+
+	lastEventID string
+}
+
+// NewStream starts an event stream response on w, sending the headers
+// straight away. If heartbeat is not zero, a comment is sent whenever that
+// long passes, so idle connections stay open and a client that has gone
+// away is noticed. The stream must be closed before the handler returns.
+//
+// The server's write timeout applies to the whole stream, so it must be
+// zero or long enough for the streams being served.
+func NewStream(w *response.Writer, r *request.Request, heartbeat time.Duration) (*Stream, error) {
+	if err := w.WriteStatusLine(response.StatusOK); err != nil {
+		return nil, err
+	}
+	h := headers.NewHeaders()
+	h.Set("Content-Type", "text/event-stream")
+	h.Set("Cache-Control", "no-cache")
+	if err := w.WriteHeaders(h); err != nil {
+		return nil, err
+	}
+	if err := w.Flush(); err != nil {
+		return nil, err
+	}
+
+	s := &Stream{
+		w:           w,
+		done:        make(chan struct{}),
+		lastEventID: r.Headers.Get("Last-Event-ID"),
+	}
+	if heartbeat > 0 {
+		s.ticker = time.NewTicker(heartbeat)
+		go s.heartbeat()
+	}
+	return s, nil
+}
+
+// LastEventID returns the ID of the last event the client saw before
+// reconnecting, or "" for a new client. Handlers use it to resume the
+// stream where it left off.
+func (s *Stream) LastEventID() string {
+	return s.lastEventID
+}
+
+// Send writes e and flushes it to the client.
+func (s *Stream) Send(e Event) error {
+	if strings.ContainsAny(e.Event, "\r\n\x00") {
+		return fmt.Errorf("%w: event %q", ErrInvalidEvent, e.Event)
+	}
+	if strings.ContainsAny(e.ID, "\r\n\x00") {
+		return fmt.Errorf("%w: id %q", ErrInvalidEvent, e.ID)
+	}
+
+	var b strings.Builder
+	if e.Event != "" {
+		fmt.Fprintf(&b, "event: %s\n", e.Event)
+	}
+	if e.ID != "" {
+		fmt.Fprintf(&b, "id: %s\n", e.ID)
+	}
+	if e.Retry > 0 {
+		fmt.Fprintf(&b, "retry: %d\n", e.Retry.Milliseconds())
+	}
+	if e.Data != "" || e.Event != "" {
+		// Each line becomes its own data field, which the client joins
+		// back together with "\n"
+		data := strings.ReplaceAll(e.Data, "\r\n", "\n")
+		data = strings.ReplaceAll(data, "\r", "\n")
+		for line := range strings.SplitSeq(data, "\n") {
+			fmt.Fprintf(&b, "data: %s\n", line)
+		}
+	}
+	b.WriteString("\n")
+	return s.write(b.String())
+}
+
+// Comment writes a comment line, which clients ignore.
+func (s *Stream) Comment(text string) error {
+	var b strings.Builder
+	for line := range strings.SplitSeq(strings.ReplaceAll(text, "\r", ""), "\n") {
+		fmt.Fprintf(&b, ": %s\n", line)
+	}
+	b.WriteString("\n")
+	return s.write(b.String())
+}
+
+// Done returns a channel that is closed once the stream ends, either
+// because it was closed or because the client went away.
+func (s *Stream) Done() <-chan struct{} {
+	return s.done
+}
+
+// Err returns why the stream ended: ErrClosed, the write error that
+// revealed the client had gone away, or nil while it is open.
+func (s *Stream) Err() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.err
+}
+
+// Close stops the heartbeat. The response is completed once the handler
+// returns.
+func (s *Stream) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.end(ErrClosed)
+	return nil
+}
+
+func (s *Stream) write(p string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.err != nil {
+		return s.err
+	}
+	_, err := s.w.WriteBody([]byte(p))
+	if err == nil {
+		err = s.w.Flush()
+	}
+	if err != nil {
+		s.end(err)
+	}
+	return err
+}
+
+// end records why the stream ended. s.mu must be held.
+func (s *Stream) end(err error) {
+	if s.err != nil {
+		return
+	}
+	s.err = err
+	if s.ticker != nil {
+		s.ticker.Stop()
+	}
+	close(s.done)
+}
+
+func (s *Stream) heartbeat() {
+	for {
+		select {
+		case <-s.done:
+			return
+		case <-s.ticker.C:
+			if s.Comment("heartbeat") != nil {
+				return
+			}
+		}
+	}
+}
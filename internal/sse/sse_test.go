@@ -0,0 +1,117 @@
+package sse
+
+import (
+	"bytes"
+	"errors"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/austin-weeks/http-from-scratch/internal/request"
+	"github.com/austin-weeks/http-from-scratch/internal/response"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// conn records what is written to it and can be made to fail, like a
+// connection to a client that went away.
+type conn struct {
+	mu      sync.Mutex
+	buf     bytes.Buffer
+	flushes int
+	broken  bool
+}
+
+func (c *conn) Write(p []byte) (int, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.broken {
+		return 0, errors.New("connection reset by peer")
+	}
+	return c.buf.Write(p)
+}
+
+func (c *conn) Flush() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.flushes++
+	return nil
+}
+
+func (c *conn) String() string {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.buf.String()
+}
+
+func newRequest(t *testing.T, extra string) *request.Request {
+	t.Helper()
+	r, err := request.RequestFromReader(strings.NewReader("GET /events HTTP/1.1\r\n" + extra + "\r\n"))
+	require.NoError(t, err)
+	return r
+}
+
+func TestStream(t *testing.T) {
+	c := &conn{}
+	w := response.NewWriter(c)
+	s, err := NewStream(w, newRequest(t, "Last-Event-ID: 41\r\n"), 0)
+	require.NoError(t, err)
+	assert.Equal(t, "41", s.LastEventID())
+
+	// Test: Headers sent immediately, with chunked encoding
+	assert.Equal(t, "HTTP/1.1 200 OK\r\nContent-Type: text/event-stream\r\nCache-Control: no-cache\r\n"+
+		"Transfer-Encoding: chunked\r\n\r\n", c.String())
+
+	// Test: Fields, with multi-line data split into data fields
+	require.NoError(t, s.Send(Event{Event: "build", ID: "42", Data: "line 1\nline 2\r\nline 3\rline 4"}))
+	assert.Contains(t, c.String(), "event: build\nid: 42\ndata: line 1\ndata: line 2\ndata: line 3\ndata: line 4\n\n")
+	assert.Equal(t, 2, c.flushes)
+
+	// Test: Retry only
+	require.NoError(t, s.Send(Event{Retry: 3 * time.Second}))
+	assert.Contains(t, c.String(), "retry: 3000\n\n")
+
+	// Test: Empty line kept in data
+	require.NoError(t, s.Send(Event{Data: "a\n\nb"}))
+	assert.Contains(t, c.String(), "data: a\ndata: \ndata: b\n\n")
+
+	// Test: Comments
+	require.NoError(t, s.Comment("hi\nthere"))
+	assert.Contains(t, c.String(), ": hi\n: there\n\n")
+
+	// Test: Line breaks in event and id rejected
+	assert.ErrorIs(t, s.Send(Event{Event: "a\nb"}), ErrInvalidEvent)
+	assert.ErrorIs(t, s.Send(Event{ID: "1\r2"}), ErrInvalidEvent)
+
+	// Test: Closed stream ends the response
+	require.NoError(t, s.Close())
+	<-s.Done()
+	assert.ErrorIs(t, s.Send(Event{Data: "late"}), ErrClosed)
+	require.NoError(t, w.Finish())
+	assert.True(t, strings.HasSuffix(c.String(), "0\r\n\r\n"))
+}
+
+func TestStreamHeartbeat(t *testing.T) {
+	c := &conn{}
+	s, err := NewStream(response.NewWriter(c), newRequest(t, ""), time.Millisecond)
+	require.NoError(t, err)
+	defer s.Close() // nolint
+	assert.Equal(t, "", s.LastEventID())
+
+	assert.Eventually(t, func() bool {
+		return strings.Contains(c.String(), ": heartbeat\n\n")
+	}, time.Second, time.Millisecond)
+
+	// Test: Disconnect noticed by the heartbeat
+	c.mu.Lock()
+	c.broken = true
+	c.mu.Unlock()
+	select {
+	case <-s.Done():
+	case <-time.After(time.Second):
+		t.Fatal("disconnect not noticed")
+	}
+	assert.ErrorContains(t, s.Err(), "connection reset")
+	assert.Error(t, s.Send(Event{Data: "x"}))
+}